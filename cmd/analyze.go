@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	analyzePkg    string
+	analyzeGroups int
+	analyzeFormat string
+)
+
+// analyze サブコマンド：パッケージ内の依存関係から分割案を提案します。
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Suggest how to split a package from its intra-package dependencies",
+	Long: "Suggest how to split a package from its intra-package dependencies.\n\n" +
+		"Files are clustered, not declarations: split moves whole files, so every declaration stays in the group of the file that holds it.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if analyzePkg == "" {
+			slog.Error("Package is required. Please specify the package directory using the --pkg flag.")
+			os.Exit(1)
+		}
+
+		absWorkDir, err := filepath.Abs(workDir)
+		if err != nil {
+			slog.Error("Failed to get absolute path of workdir", slog.Any("error", err))
+			os.Exit(1)
+		}
+		absPkgDir := analyzePkg
+		if !filepath.IsAbs(absPkgDir) {
+			absPkgDir = filepath.Join(absWorkDir, absPkgDir)
+		}
+		buildFlags := []string{}
+		if tagsFlag != "" {
+			buildFlags = append(buildFlags, "-tags", tagsFlag)
+		}
+
+		suggestion, err := pachanger.AnalyzePackage(absWorkDir, filepath.Clean(absPkgDir), analyzeGroups, buildFlags)
+		if err != nil {
+			slog.Error("Failed to analyze package", slog.String("pkg", analyzePkg), slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		switch analyzeFormat {
+		case "json":
+			err = suggestion.WriteJSON(os.Stdout)
+		case "text":
+			err = suggestion.WriteText(os.Stdout)
+		default:
+			slog.Error("Unknown format", slog.String("format", analyzeFormat))
+			os.Exit(1)
+		}
+		if err != nil {
+			slog.Error("Failed to write suggestion", slog.Any("error", err))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cdir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	rootCmd.AddCommand(analyzeCmd)
+
+	analyzeCmd.Flags().StringVar(&analyzePkg, "pkg", "", "Directory of the package to analyze (required)")
+	analyzeCmd.Flags().IntVar(&analyzeGroups, "groups", 2, "Number of packages to split into")
+	analyzeCmd.Flags().StringVar(&analyzeFormat, "format", "text", "Output format (text or json)")
+	analyzeCmd.Flags().StringVar(&workDir, "workdir", cdir, "Working directory (default: current directory)")
+	analyzeCmd.Flags().StringVar(&tagsFlag, "tags", "", "Build tags (e.g. 'test,integration')")
+}
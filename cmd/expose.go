@@ -9,8 +9,9 @@ import (
 )
 
 var (
-	targetFile string
-	execute    bool
+	targetFile   string
+	execute      bool
+	exposeFormat string
 )
 
 // expose サブコマンド：未エクスポートなシンボルを外部に露出させるためのリネーム生成を行います。
@@ -28,10 +29,29 @@ var exposeCmd = &cobra.Command{
 			slog.Error("Failed to initialize ExposeRenamer", slog.Any("error", err))
 			os.Exit(1)
 		}
-		if err := renamer.Generate(); err != nil {
+		report, err := renamer.Report()
+		if err != nil {
 			slog.Error("Rename generation failed", slog.String("target_file", targetFile), slog.Any("error", err))
 			os.Exit(1)
 		}
+		// --format が指定されていれば、公開が必要な理由を含むレポートを出力する
+		switch exposeFormat {
+		case "":
+		case "text":
+			err = report.WriteText(os.Stdout)
+		case "json":
+			err = report.WriteJSON(os.Stdout)
+		case "dot":
+			err = report.WriteDOT(os.Stdout)
+		default:
+			slog.Error("Unknown format", slog.String("format", exposeFormat))
+			os.Exit(1)
+		}
+		if err != nil {
+			slog.Error("Failed to write report", slog.Any("error", err))
+			os.Exit(1)
+		}
+		renamer.Run(report)
 
 		slog.Info("Rename generation completed successfully", slog.String("target_file", targetFile))
 	},
@@ -50,4 +70,5 @@ func init() {
 	exposeCmd.Flags().StringVar(&targetFile, "file", "", "Path to the target Go file (required)")
 	exposeCmd.Flags().StringVar(&workDir, "workdir", cdir, "Working directory (default: current directory)")
 	exposeCmd.Flags().BoolVar(&execute, "execute", false, "Execute the renaming (default: false)")
+	exposeCmd.Flags().StringVar(&exposeFormat, "format", "", "Print a report of the symbols to expose and why (text, json or dot)")
 }
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/spf13/cobra"
+)
+
+// externalize-test サブコマンド：内部テストを外部テストパッケージへ移します。
+var externalizeTestCmd = &cobra.Command{
+	Use:   "externalize-test",
+	Short: "Move an internal test file into the external test package",
+	Run: func(cmd *cobra.Command, args []string) {
+		setupLogger()
+		if testFile == "" {
+			slog.Error("Test file is required. Please specify the test file using the --file flag.")
+			os.Exit(1)
+		}
+
+		absWorkDir, err := filepath.Abs(workDir)
+		if err != nil {
+			slog.Error("Failed to get absolute path of workdir", slog.Any("error", err))
+			os.Exit(1)
+		}
+		absTestFile := testFile
+		if !filepath.IsAbs(absTestFile) {
+			absTestFile = filepath.Join(absWorkDir, absTestFile)
+		}
+		buildFlags := []string{}
+		if tagsFlag != "" {
+			buildFlags = append(buildFlags, "-tags", tagsFlag)
+		}
+
+		journal, err := pachanger.NewJournal(absWorkDir, os.Args[1:])
+		if err != nil {
+			slog.Error("Failed to create journal", slog.Any("error", err))
+			os.Exit(1)
+		}
+		summary, err := pachanger.ExternalizeTest(journal, absWorkDir, filepath.Clean(absTestFile), suffix, buildFlags)
+		if saveErr := journal.Save(); saveErr != nil {
+			slog.Error("Failed to save journal", slog.Any("error", saveErr))
+		}
+		if err != nil {
+			slog.Error("Failed to externalize test", slog.String("test_file", testFile), slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		for _, shim := range summary.Shims {
+			slog.Info("Exported for test", slog.String("name", shim))
+		}
+		slog.Info("Externalize completed",
+			slog.String("test_file", testFile),
+			slog.Int("references", summary.References),
+			slog.Int("literals", summary.Literals),
+			slog.Int("shims", len(summary.Shims)),
+		)
+	},
+}
+
+func init() {
+	cdir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	rootCmd.AddCommand(externalizeTestCmd)
+
+	externalizeTestCmd.Flags().StringVar(&testFile, "file", "", "Path to the internal test file (required)")
+	externalizeTestCmd.Flags().StringVar(&suffix, "suffix", "ForTest", "Suffix to add to the names exported for the test")
+	externalizeTestCmd.Flags().StringVar(&workDir, "workdir", cdir, "Working directory (default: current directory)")
+	externalizeTestCmd.Flags().StringVar(&tagsFlag, "tags", "", "Build tags (e.g. 'test,integration')")
+	externalizeTestCmd.Flags().BoolVar(&debug, "debug", false, "debug mode")
+}
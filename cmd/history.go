@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/spf13/cobra"
+)
+
+// history サブコマンド：ジャーナルに記録された過去の実行を一覧表示します。
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List recorded runs that can be undone",
+	Run: func(cmd *cobra.Command, args []string) {
+		journals, err := pachanger.LoadJournals(workDir)
+		if err != nil {
+			slog.Error("Failed to load journals", slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		for _, j := range journals {
+			status := ""
+			if j.Undone {
+				status = " (undone)"
+			}
+			fmt.Printf("%s\t%s\t%d files%s\tpachanger %s\n",
+				j.ID,
+				j.CreatedAt.Format("2006-01-02 15:04:05"),
+				len(j.Files),
+				status,
+				strings.Join(j.Args, " "),
+			)
+		}
+	},
+}
+
+func init() {
+	cdir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().StringVar(&workDir, "workdir", cdir, "Working directory (default: current directory)")
+}
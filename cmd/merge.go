@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeFrom string
+	mergeInto string
+)
+
+// merge サブコマンド：パッケージを別のパッケージへ統合します。
+var mergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Merge a package into another package",
+	Run: func(cmd *cobra.Command, args []string) {
+		if mergeFrom == "" || mergeInto == "" {
+			if err := cmd.Help(); err != nil {
+				slog.Error("Failed to show help", slog.Any("error", err))
+			}
+			slog.Error("Required flag(s) not set")
+			os.Exit(1)
+		}
+
+		if err := runMerge(); err != nil {
+			slog.Error("Failed to merge package", slog.String("from", mergeFrom), slog.String("into", mergeInto), slog.Any("error", err))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cdir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	rootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().StringVar(&mergeFrom, "from", "", "Directory of the package to merge (required)")
+	mergeCmd.Flags().StringVar(&mergeInto, "into", "", "Directory of the package to merge into (required)")
+	mergeCmd.Flags().StringVar(&workDir, "workdir", cdir, "Working directory (default: current directory)")
+	mergeCmd.Flags().StringVar(&tagsFlag, "tags", "", "Build tags (e.g. 'test,integration')")
+	mergeCmd.Flags().BoolVar(&debug, "debug", false, "debug mode")
+}
+
+func runMerge() error {
+	setupLogger()
+
+	ctx := context.Background()
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of workdir: %w", err)
+	}
+	buildFlags := []string{}
+	if tagsFlag != "" {
+		buildFlags = append(buildFlags, "-tags", tagsFlag)
+	}
+
+	absFrom, absInto := mergeFrom, mergeInto
+	if !filepath.IsAbs(absFrom) {
+		absFrom = filepath.Join(absWorkDir, absFrom)
+	}
+	if !filepath.IsAbs(absInto) {
+		absInto = filepath.Join(absWorkDir, absInto)
+	}
+	absFrom, absInto = filepath.Clean(absFrom), filepath.Clean(absInto)
+
+	plan, err := pachanger.PlanMerge(absWorkDir, absFrom, absInto, buildFlags)
+	if err != nil {
+		return err
+	}
+
+	journal, err := pachanger.NewJournal(absWorkDir, os.Args[1:])
+	if err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+
+	if err := mergePackage(ctx, journal, absWorkDir, plan, buildFlags); err != nil {
+		rollback(ctx, journal)
+		return err
+	}
+
+	// 空になったディレクトリは削除する
+	if entries, err := os.ReadDir(absFrom); err == nil && len(entries) == 0 {
+		if err := os.Remove(absFrom); err != nil {
+			slog.WarnContext(ctx, "Failed to remove empty directory", slog.String("dir", absFrom), slog.Any("error", err))
+		}
+	}
+
+	if err := journal.Save(); err != nil {
+		return fmt.Errorf("failed to save journal: %w", err)
+	}
+	slog.InfoContext(ctx, "Successfully merged package", slog.String("from", mergeFrom), slog.String("into", mergeInto), slog.String("run", journal.ID))
+	return nil
+}
+
+func mergePackage(ctx context.Context, journal *pachanger.Journal, absWorkDir string, plan *pachanger.MergePlan, buildFlags []string) error {
+	if err := moveGroup(ctx, journal, absWorkDir, plan.Files, plan.PkgName, plan.IntoDir, buildFlags); err != nil {
+		return err
+	}
+	for _, f := range plan.ExternalTests {
+		dst := filepath.Join(plan.IntoDir, filepath.Base(f))
+		slog.InfoContext(ctx, "Moving external test file", slog.String("file", f), slog.String("output", dst))
+		if err := pachanger.MoveExternalTest(journal, absWorkDir, f, dst, plan.PkgName); err != nil {
+			return fmt.Errorf("failed to move external test file: %w", err)
+		}
+	}
+	return nil
+}
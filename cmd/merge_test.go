@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunMerge(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a/a.go": "package a\n\nimport \"example.com/mod/b\"\n\nfunc Hello() string { return \"a\" + b.World() }\n",
+		"a/a_test.go": "package a_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/a\"\n)\n\n" +
+			"func TestHello(t *testing.T) { _ = a.Hello() }\n",
+		"b/b.go": "package b\n\nfunc World() string { return \"b\" }\n",
+		"app/app.go": "package app\n\nimport (\n\t\"example.com/mod/a\"\n\t\"example.com/mod/b\"\n)\n\n" +
+			"var S = a.Hello() + b.World()\n",
+	})
+	workDir, mergeFrom, mergeInto, tagsFlag = dir, "a", "b", ""
+	assert.NoError(t, runMerge())
+
+	assert.NoDirExists(t, filepath.Join(dir, "a"))
+	// 統合先のパッケージへの import はなくなる
+	merged := readFile(t, dir, "b/a.go")
+	assert.Contains(t, merged, "package b\n")
+	assert.NotContains(t, merged, "import")
+	assert.Contains(t, merged, "return \"a\" + World()")
+
+	test := readFile(t, dir, "b/a_test.go")
+	assert.Contains(t, test, "package b_test\n")
+	assert.Contains(t, test, "\"example.com/mod/b\"")
+	assert.Contains(t, test, "_ = b.Hello()")
+
+	app := readFile(t, dir, "app/app.go")
+	assert.NotContains(t, app, "\"example.com/mod/a\"")
+	assert.Contains(t, app, "var S = b.Hello() + b.World()\n")
+	buildModule(t, dir)
+}
@@ -3,15 +3,20 @@ package cmd
 import (
 	"log/slog"
 	"os"
+	"path/filepath"
 
 	"github.com/pyama86/pachanger/internal/pachanger"
 	"github.com/spf13/cobra"
 )
 
 var (
-	suffix    string
-	testFile  string
-	targetPkg string
+	suffix     string
+	testFile   string
+	targetPkg  string
+	style      string
+	exportTest bool
+	roundTrip  bool
+	revert     bool
 )
 
 // migrate struct コマンドのサブコマンド
@@ -19,8 +24,8 @@ var migrateStructCmd = &cobra.Command{
 	Use:   "struct",
 	Short: "Migrate structs in the test file and add suffix to struct names",
 	Run: func(cmd *cobra.Command, args []string) {
-		if testFile == "" {
-			slog.Error("Test file is required")
+		if targetPkg == "" {
+			slog.Error("Target package is required")
 			os.Exit(1)
 		}
 
@@ -28,17 +33,68 @@ var migrateStructCmd = &cobra.Command{
 			suffix = "ForTest"
 		}
 
+		ctorStyle, err := pachanger.ParseConstructorStyle(style)
+		if err != nil {
+			slog.Error("Invalid style", slog.Any("error", err))
+			os.Exit(1)
+		}
+
 		ms, err := pachanger.NewMigrateStruct(workDir, targetPkg, suffix)
 		if err != nil {
 			slog.Error("Failed to create MigrateStruct", slog.Any("error", err))
 			os.Exit(1)
 		}
-		if err := ms.Migrate(testFile); err != nil {
+		ms.SetStyle(ctorStyle)
+		ms.SetExportTest(exportTest)
+		ms.SetRoundTripTest(roundTrip)
+		journal, err := pachanger.NewJournal(workDir, os.Args[1:])
+		if err != nil {
+			slog.Error("Failed to create journal", slog.Any("error", err))
+			os.Exit(1)
+		}
+		ms.SetJournal(journal)
+		// --file がなければモジュール内のすべてのテストファイルを対象にする
+		var summary *pachanger.MigrateSummary
+		if testFile != "" && !filepath.IsAbs(testFile) {
+			testFile = filepath.Join(workDir, testFile)
+		}
+		switch {
+		case revert && testFile != "":
+			summary, err = ms.RevertFiles([]string{testFile})
+		case revert:
+			summary, err = ms.RevertAll()
+		case testFile != "":
+			summary, err = ms.MigrateFiles([]string{testFile})
+		default:
+			summary, err = ms.MigrateAll()
+		}
+		if saveErr := journal.Save(); saveErr != nil {
+			slog.Error("Failed to save journal", slog.Any("error", saveErr))
+		}
+		if err != nil {
 			slog.Error("Failed to migrate struct", slog.String("test_file", testFile), slog.Any("error", err))
 			os.Exit(1)
 		}
 
-		slog.Info("Refactor completed", slog.String("test_file", testFile))
+		for _, f := range summary.Files {
+			slog.Info("Rewrote test file", slog.String("file", f))
+		}
+		if revert {
+			slog.Info("Revert completed",
+				slog.Int("files", len(summary.Files)),
+				slog.Int("literals", summary.Literals),
+				slog.Int("removed_constructors", len(summary.Constructors)),
+			)
+			return
+		}
+		for _, ref := range summary.Unreachable {
+			slog.Warn("Literal was not rewritten; export_test.go is only visible to tests in the struct's directory", slog.String("ref", ref.String()))
+		}
+		slog.Info("Refactor completed",
+			slog.Int("files", len(summary.Files)),
+			slog.Int("literals", summary.Literals),
+			slog.Int("constructors", len(summary.Constructors)),
+		)
 	},
 }
 
@@ -52,7 +108,11 @@ func init() {
 
 	// オプション引数をサブコマンドに追加
 	migrateStructCmd.Flags().StringVar(&suffix, "suffix", "ForTest", "Suffix to add to struct names")
-	migrateStructCmd.Flags().StringVar(&testFile, "file", "", "Path to the test file (required)")
-	migrateStructCmd.Flags().StringVar(&targetPkg, "pkg", "", "Target package name (required)")
+	migrateStructCmd.Flags().StringVar(&testFile, "file", "", "Path to the test file (default: every test file in the module that uses structs of --pkg)")
+	migrateStructCmd.Flags().StringVar(&targetPkg, "pkg", "", "Target package name or pattern such as ./internal/handler/...; only structs with unexported fields are migrated (required)")
+	migrateStructCmd.Flags().StringVar(&style, "style", string(pachanger.StyleParams), "Constructor style to generate (params, options, builder)")
+	migrateStructCmd.Flags().BoolVar(&exportTest, "export-test", false, "Generate constructors into export_test.go instead of the production source; literals in tests of other directories are reported instead of rewritten")
+	migrateStructCmd.Flags().BoolVar(&roundTrip, "roundtrip-test", false, "Generate a test per struct checking that every constructor argument reaches its field")
+	migrateStructCmd.Flags().BoolVar(&revert, "revert", false, "Turn generated constructor calls back into struct literals and delete unused generated code")
 	migrateStructCmd.Flags().StringVar(&workDir, "workdir", cdir, "Working directory (default: current directory)")
 }
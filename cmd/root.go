@@ -26,6 +26,14 @@ var (
 	addPrefix    string
 	tagsFlag     string
 	debug        bool
+	since        string
+	fromGitDiff  bool
+	leaveShims   bool
+	mentions     bool
+	dotImport    string
+	moveMocks    bool
+	generated    string
+	stringRefs   string
 )
 
 var rootCmd = &cobra.Command{
@@ -68,11 +76,20 @@ func init() {
 	rootCmd.Flags().StringVar(&addPrefix, "add-prefix", "", "Add prefix to symbol name")
 	rootCmd.Flags().StringVar(&tagsFlag, "tags", "", "Build tags (e.g. 'test,integration')")
 	rootCmd.Flags().BoolVar(&debug, "debug", false, "debug mode")
+	rootCmd.Flags().StringVar(&since, "since", "", "Only rewrite files changed since the given git revision")
+	rootCmd.Flags().BoolVar(&fromGitDiff, "files-from-git-diff", false, "Only rewrite files reported by 'git diff' (against --since, default: HEAD)")
+	rootCmd.Flags().BoolVar(&leaveShims, "leave-shims", false, "Leave deprecated aliases and forwarders to the moved symbols in the old package")
+	rootCmd.Flags().BoolVar(&mentions, "rewrite-comment-mentions", false, "Also rewrite plain-text mentions such as 'oldpkg.Foo' in comments, not only doc links")
+	rootCmd.Flags().BoolVar(&moveMocks, "move-mocks", false, "Move generated mocks of moved interfaces that live in the same package along with them")
+	rootCmd.Flags().StringVar(&generated, "generated", string(pachanger.GeneratedRewrite), "How to handle files with a 'Code generated ... DO NOT EDIT.' header (rewrite, skip, regenerate)")
+	rootCmd.Flags().StringVar(&dotImport, "dot-import", string(pachanger.DotImportKeep), "How to rewrite dot-imported uses of moved symbols (keep, qualify)")
+	rootCmd.Flags().StringVar(&stringRefs, "string-refs", string(pachanger.StringRefOff), "How to handle string literals such as \"oldpkg.Foo\" that name moved symbols (off, report, rewrite)")
 }
 
 // determineOutputFile は、outputPath が空や相対パスの場合に正しい絶対パスを返し、
 // ディレクトリが存在しない場合は作成します。
 func determineOutputFile(
+	journal *pachanger.Journal,
 	absWorkDir string,
 	absTargetFile string,
 	outputPath string,
@@ -101,14 +118,14 @@ func determineOutputFile(
 	}
 
 	// 出力先ディレクトリがない場合は作成
-	if err := os.MkdirAll(filepath.Dir(absOutputFile), 0o755); err != nil {
+	if err := journal.MkdirAll(filepath.Dir(absOutputFile)); err != nil {
 		return "", err
 	}
 
 	return absOutputFile, nil
 }
 
-func run() error {
+func setupLogger() {
 	level := slog.LevelInfo
 	if debug {
 		level = slog.LevelDebug
@@ -123,6 +140,10 @@ func run() error {
 			),
 		),
 	)
+}
+
+func run() error {
+	setupLogger()
 
 	ctx := context.Background()
 	buildFlags := []string{}
@@ -136,6 +157,19 @@ func run() error {
 		return fmt.Errorf("go.mod not found in workdir: %w", err)
 	}
 
+	dotImportMode, err := pachanger.ParseDotImportMode(dotImport)
+	if err != nil {
+		return err
+	}
+	generatedPolicy, err := pachanger.ParseGeneratedPolicy(generated)
+	if err != nil {
+		return err
+	}
+	stringRefMode, err := pachanger.ParseStringRefMode(stringRefs)
+	if err != nil {
+		return err
+	}
+
 	if tagsFlag != "" {
 		buildFlags = append(buildFlags, "-tags", tagsFlag)
 	}
@@ -184,24 +218,95 @@ func run() error {
 		return fmt.Errorf("failed to create transformer: %w", err)
 	}
 
-	for _, absTargetFile := range expanded {
-		slog.InfoContext(ctx, "Processing target file", slog.String("file", absTargetFile))
-		absOutputFile, err := determineOutputFile(absWorkDir, absTargetFile, outputPath)
+	// 変更内容をジャーナルに記録し、undoで戻せるようにする
+	journal, err := pachanger.NewJournal(absWorkDir, os.Args[1:])
+	if err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+	defer func() {
+		if err := journal.Save(); err != nil {
+			slog.Error("Failed to save journal", slog.Any("error", err))
+			return
+		}
+		slog.InfoContext(ctx, "Saved journal", slog.String("run", journal.ID))
+	}()
+	transformer.SetJournal(journal)
+	transformer.SetLeaveShims(leaveShims)
+	transformer.SetRewriteMentions(mentions)
+	transformer.SetDotImportMode(dotImportMode)
+	transformer.SetMoveMocks(moveMocks)
+	transformer.SetGeneratedPolicy(generatedPolicy)
+	transformer.SetStringRefMode(stringRefMode)
+
+	// 書き換え対象をgitの差分があるファイルに限定する
+	if since != "" || fromGitDiff {
+		rev := since
+		if rev == "" {
+			rev = "HEAD"
+		}
+		changed, err := pachanger.GitChangedFiles(absWorkDir, rev)
+		if err != nil {
+			return fmt.Errorf("failed to get changed files: %w", err)
+		}
+		slog.InfoContext(ctx, "Restricting rewrites to changed files", slog.String("since", rev), slog.Int("count", len(changed)))
+		transformer.SetFileFilter(changed)
+	}
+
+	if err := moveFiles(ctx, transformer, journal, absWorkDir, expanded, outputPath); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Successfully updated references", slog.String("newPkg", newPkg))
+	return nil
+}
+
+// moveFiles はターゲットファイルを outputPath へ移動し、モジュール内の参照を書き換える
+func moveFiles(
+	ctx context.Context,
+	transformer *pachanger.Transformer,
+	journal *pachanger.Journal,
+	absWorkDir string,
+	targets []string,
+	outputPath string,
+) error {
+	outputs := map[string]string{}
+	for _, absTargetFile := range targets {
+		absOutputFile, err := determineOutputFile(journal, absWorkDir, absTargetFile, outputPath)
 		if err != nil {
 			return fmt.Errorf("failed to determine output file: %w", err)
 		}
+		outputs[absTargetFile] = absOutputFile
+	}
+
+	// 移動するインターフェースのモックを探し、指定があればインターフェースの隣へ移動する
+	mocks, err := transformer.FindMocks(outputs)
+	if err != nil {
+		return fmt.Errorf("failed to find mocks: %w", err)
+	}
+	for _, mock := range mocks {
+		slog.InfoContext(ctx, "Found mock of moved interfaces", slog.String("file", mock.Path), slog.String("interfaces", strings.Join(mock.Interfaces, ",")))
+		if mock.Output != "" {
+			targets = append(targets, mock.Path)
+			outputs[mock.Path] = mock.Output
+		}
+	}
+
+	// go:embed で埋め込んでいるファイルは、書き換えを始める前に移動できるか確認する
+	assets, err := transformer.PlanEmbeddedAssets(outputs)
+	if err != nil {
+		return fmt.Errorf("failed to plan embedded files: %w", err)
+	}
+
+	for _, absTargetFile := range targets {
+		slog.InfoContext(ctx, "Processing target file", slog.String("file", absTargetFile))
+		absOutputFile := outputs[absTargetFile]
 
 		// ターゲットファイルと出力ファイルが異なる場合、既存の出力ファイルを削除
 		if absTargetFile != absOutputFile {
-			if err := os.Remove(absOutputFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			if err := journal.Remove(absOutputFile); err != nil && !errors.Is(err, os.ErrNotExist) {
 				return fmt.Errorf("failed to remove output file: %w", err)
 			}
 		}
 
-		if err != nil {
-			return fmt.Errorf("failed to create transformer: %w", err)
-		}
-
 		if err := transformer.TransformSymbolsInTargetFile(absTargetFile, absOutputFile); err != nil {
 			return fmt.Errorf("failed to transform symbols in target file: %w", err)
 		}
@@ -227,7 +332,7 @@ func run() error {
 				return transformer.TransformSymbolsInOtherFile(original, output)
 			})
 		}
-		err = filepath.WalkDir(absWorkDir, func(path string, d os.DirEntry, walkErr error) error {
+		err := filepath.WalkDir(absWorkDir, func(path string, d os.DirEntry, walkErr error) error {
 			if walkErr != nil {
 				return walkErr
 			}
@@ -262,7 +367,10 @@ func run() error {
 
 		// ターゲットファイルを削除
 		if absTargetFile != absOutputFile {
-			if err := os.Remove(absTargetFile); err != nil {
+			if err := journal.RecordMove(absTargetFile, absOutputFile); err != nil {
+				return fmt.Errorf("failed to record moved file: %w", err)
+			}
+			if err := journal.Remove(absTargetFile); err != nil {
 				return fmt.Errorf("failed to remove target file: %w", err)
 			}
 		}
@@ -271,6 +379,60 @@ func run() error {
 	if err := transformer.Dump(); err != nil {
 		return fmt.Errorf("failed to dump transformer: %w", err)
 	}
-	slog.InfoContext(ctx, "Successfully updated references", slog.String("newPkg", newPkg))
+
+	// 埋め込まれているファイルは移動先のパッケージのディレクトリへ同じ配置で移動する
+	if err := pachanger.MoveEmbeddedAssets(journal, assets); err != nil {
+		return fmt.Errorf("failed to move embedded files: %w", err)
+	}
+	for _, asset := range assets {
+		slog.InfoContext(ctx, "Moved embedded file", slog.String("from", asset.From), slog.String("to", asset.To))
+	}
+
+	// 移動元のパッケージに、移動したシンボルへ転送する宣言を残す
+	shimFiles, err := transformer.WriteShims()
+	if err != nil {
+		return fmt.Errorf("failed to write shims: %w", err)
+	}
+	for _, f := range shimFiles {
+		slog.InfoContext(ctx, "Left shims in the old package", slog.String("file", f))
+	}
+	for _, v := range transformer.UnshimmedVars() {
+		slog.WarnContext(ctx, "Variable was not shimmed; update users of the old package by hand", slog.String("var", v.String()))
+	}
+
+	for _, w := range transformer.DirectiveWarnings() {
+		slog.WarnContext(ctx, "Directive needs manual update", slog.String("directive", w.String()))
+	}
+
+	// 生成されたファイルは次に生成し直すと書き換えが失われるため、まとめて報告する
+	for _, g := range transformer.GeneratedFiles() {
+		if g.Rewritten {
+			slog.InfoContext(ctx, "Rewrote generated file", slog.String("file", g.File), slog.String("generator", g.Generator))
+		} else {
+			slog.WarnContext(ctx, "Generated file was not rewritten and will break", slog.String("file", g.File), slog.String("generator", g.Generator), slog.Int("references", len(g.References)))
+		}
+		for _, c := range g.Commands {
+			slog.WarnContext(ctx, "Re-run generator", slog.String("file", g.File), slog.String("command", c.String()))
+		}
+		if len(g.Commands) == 0 && !g.Rewritten {
+			slog.WarnContext(ctx, "No go:generate command found for generated file", slog.String("file", g.File))
+		}
+	}
+
+	// 文字列で書かれた型の名前は実行時まで壊れたことに気付けないため、書き換えたものも含めて報告する
+	for _, ref := range transformer.StringReferences() {
+		if ref.Rewritten {
+			slog.InfoContext(ctx, "Rewrote string reference", slog.String("ref", ref.String()))
+		} else {
+			slog.WarnContext(ctx, "String reference to moved symbol", slog.String("ref", ref.String()))
+		}
+	}
+
+	if refs := transformer.SkippedReferences(); len(refs) > 0 {
+		for _, ref := range refs {
+			slog.WarnContext(ctx, "Reference left in skipped file will break", slog.String("ref", ref.String()))
+		}
+		slog.WarnContext(ctx, "Some files were not rewritten", slog.Int("references", len(refs)))
+	}
 	return nil
 }
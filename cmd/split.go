@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	splitPkg      string
+	splitMappings []string
+)
+
+// split サブコマンド：パッケージをファイル名のパターンに従って複数のパッケージに分割します。
+var splitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Split a package into several packages by file name patterns",
+	Run: func(cmd *cobra.Command, args []string) {
+		if splitPkg == "" || len(splitMappings) == 0 {
+			if err := cmd.Help(); err != nil {
+				slog.Error("Failed to show help", slog.Any("error", err))
+			}
+			slog.Error("Required flag(s) not set")
+			os.Exit(1)
+		}
+
+		if err := runSplit(); err != nil {
+			slog.Error("Failed to split package", slog.String("pkg", splitPkg), slog.Any("error", err))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cdir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	rootCmd.AddCommand(splitCmd)
+
+	splitCmd.Flags().StringVar(&splitPkg, "pkg", "", "Directory of the package to split (required)")
+	splitCmd.Flags().StringArrayVar(&splitMappings, "map", nil, "Mapping of file name pattern to new package directory, e.g. 'user*.go=internal/model/user' (required, repeatable)")
+	splitCmd.Flags().StringVar(&workDir, "workdir", cdir, "Working directory (default: current directory)")
+	splitCmd.Flags().StringVar(&tagsFlag, "tags", "", "Build tags (e.g. 'test,integration')")
+	splitCmd.Flags().BoolVar(&debug, "debug", false, "debug mode")
+}
+
+func runSplit() error {
+	setupLogger()
+
+	ctx := context.Background()
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of workdir: %w", err)
+	}
+	buildFlags := []string{}
+	if tagsFlag != "" {
+		buildFlags = append(buildFlags, "-tags", tagsFlag)
+	}
+
+	absPkgDir := splitPkg
+	if !filepath.IsAbs(absPkgDir) {
+		absPkgDir = filepath.Join(absWorkDir, absPkgDir)
+	}
+	var mappings []pachanger.SplitMapping
+	for _, m := range splitMappings {
+		mapping, err := pachanger.ParseSplitMapping(absWorkDir, m)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	groups, err := pachanger.PlanSplit(absWorkDir, filepath.Clean(absPkgDir), mappings, buildFlags)
+	if err != nil {
+		return err
+	}
+
+	journal, err := pachanger.NewJournal(absWorkDir, os.Args[1:])
+	if err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+
+	// 1グループずつ移動し、途中で失敗した場合はすべての変更を元に戻す
+	for _, g := range groups {
+		slog.InfoContext(ctx, "Moving files", slog.String("pkg", g.PkgName), slog.String("dir", g.Dir), slog.Int("files", len(g.Files)))
+		if err := moveGroup(ctx, journal, absWorkDir, g.Files, g.PkgName, g.Dir, buildFlags); err != nil {
+			rollback(ctx, journal)
+			return err
+		}
+	}
+
+	if err := journal.Save(); err != nil {
+		return fmt.Errorf("failed to save journal: %w", err)
+	}
+	slog.InfoContext(ctx, "Successfully split package", slog.String("pkg", splitPkg), slog.String("run", journal.ID))
+	return nil
+}
+
+// moveGroup はパッケージを読み込み直してから files を dir のパッケージ pkgName へ移動する
+// 先に移動したグループの変更を反映させるため、グループごとに Transformer を作り直す
+func moveGroup(ctx context.Context, journal *pachanger.Journal, absWorkDir string, files []string, pkgName, dir string, buildFlags []string) error {
+	transformer, err := pachanger.NewTransformer(absWorkDir, pkgName, "", "", buildFlags)
+	if err != nil {
+		return fmt.Errorf("failed to create transformer: %w", err)
+	}
+	transformer.SetJournal(journal)
+	return moveFiles(ctx, transformer, journal, absWorkDir, files, dir)
+}
+
+// rollback はジャーナルに記録された変更をすべて元に戻す
+func rollback(ctx context.Context, journal *pachanger.Journal) {
+	slog.WarnContext(ctx, "Rolling back changes", slog.String("run", journal.ID))
+	if err := journal.Save(); err != nil {
+		slog.ErrorContext(ctx, "Failed to save journal", slog.Any("error", err))
+		return
+	}
+	if err := journal.Undo(true); err != nil {
+		slog.ErrorContext(ctx, "Failed to roll back changes", slog.String("run", journal.ID), slog.Any("error", err))
+	}
+}
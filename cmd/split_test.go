@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeModule は files を書き出したモジュールを一時ディレクトリに作る
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/mod\n\ngo 1.23\n"
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	return dir
+}
+
+// buildModule はモジュールのテストも含めてコンパイルできるかを確かめる
+func buildModule(t *testing.T, dir string) {
+	t.Helper()
+	for _, args := range [][]string{{"build", "./..."}, {"vet", "./..."}} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestRunSplit(t *testing.T) {
+	files := map[string]string{
+		"model/user.go":  "package model\n\ntype User struct {\n\tOrders []Order\n}\n",
+		"model/order.go": "package model\n\ntype Order struct {\n\tID int\n}\n",
+		"model/base.go":  "package model\n\nconst Version = 1\n",
+		"app/app.go": "package app\n\nimport \"example.com/mod/model\"\n\n" +
+			"var U = model.User{Orders: []model.Order{{ID: model.Version}}}\n",
+		"app/app_test.go": "package app_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/model\"\n)\n\n" +
+			"func TestOrder(t *testing.T) { _ = model.Order{} }\n",
+	}
+
+	t.Run("分割して参照を書き換える場合", func(t *testing.T) {
+		dir := writeModule(t, files)
+		workDir, splitPkg, splitMappings, tagsFlag = dir, "model", []string{"user*.go=model/user", "order*.go=model/order"}, ""
+		assert.NoError(t, runSplit())
+
+		assert.NoFileExists(t, filepath.Join(dir, "model/user.go"))
+		assert.NoFileExists(t, filepath.Join(dir, "model/order.go"))
+		user := readFile(t, dir, "model/user/user.go")
+		assert.Contains(t, user, "package user\n")
+		assert.Contains(t, user, "\"example.com/mod/model/order\"")
+		assert.Contains(t, user, "Orders []order.Order\n")
+		assert.Contains(t, readFile(t, dir, "model/order/order.go"), "package order\n")
+
+		app := readFile(t, dir, "app/app.go")
+		assert.Contains(t, app, "var U = user.User{Orders: []order.Order{{ID: model.Version}}}\n")
+		assert.Contains(t, readFile(t, dir, "app/app_test.go"), "_ = order.Order{}")
+		buildModule(t, dir)
+	})
+
+	t.Run("途中で失敗した場合は元に戻す場合", func(t *testing.T) {
+		failing := map[string]string{
+			// 残るファイルと同じファイルを埋め込んでいるため、最後のグループの移動に失敗する
+			"model/zasset.go": "package model\n\nimport _ \"embed\"\n\n//go:embed data.txt\nvar Asset string\n",
+			"model/embed.go":  "package model\n\nimport _ \"embed\"\n\n//go:embed data.txt\nvar Data string\n",
+			"model/data.txt":  "data\n",
+		}
+		for name, content := range files {
+			failing[name] = content
+		}
+		dir := writeModule(t, failing)
+		workDir, splitPkg, splitMappings, tagsFlag = dir, "model", []string{"user*.go=model/user", "zasset*.go=model/zasset"}, ""
+		assert.ErrorContains(t, runSplit(), "is shared by")
+
+		for name, content := range failing {
+			assert.Equal(t, content, readFile(t, dir, name), name)
+		}
+		assert.NoDirExists(t, filepath.Join(dir, "model/user"))
+		buildModule(t, dir)
+	})
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/spf13/cobra"
+)
+
+var forceUndo bool
+
+// undo サブコマンド：ジャーナルに記録された実行を取り消します。
+var undoCmd = &cobra.Command{
+	Use:   "undo [run-id]",
+	Short: "Restore the files changed by a recorded run (default: the latest run)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id := ""
+		if len(args) > 0 {
+			id = args[0]
+		}
+
+		journal, err := pachanger.LoadJournal(workDir, id)
+		if err != nil {
+			slog.Error("Failed to load journal", slog.Any("error", err))
+			os.Exit(1)
+		}
+		if err := journal.Undo(forceUndo); err != nil {
+			slog.Error("Failed to undo run", slog.String("run", journal.ID), slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		slog.Info("Undo completed successfully", slog.String("run", journal.ID), slog.Int("files", len(journal.Files)))
+	},
+}
+
+func init() {
+	cdir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	rootCmd.AddCommand(undoCmd)
+
+	undoCmd.Flags().StringVar(&workDir, "workdir", cdir, "Working directory (default: current directory)")
+	undoCmd.Flags().BoolVar(&forceUndo, "force", false, "Restore files even if they were changed after the run")
+}
@@ -7,7 +7,6 @@ require (
 	github.com/stretchr/testify v1.11.1
 	golang.org/x/mod v0.38.0
 	golang.org/x/sync v0.22.0
-	golang.org/x/text v0.30.0
 	golang.org/x/tools v0.48.0
 )
 
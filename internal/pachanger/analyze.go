@@ -0,0 +1,330 @@
+package pachanger
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SplitSuggestion はパッケージ内の依存関係から求めた分割の提案
+type SplitSuggestion struct {
+	PkgPath string           `json:"pkg_path"`
+	PkgDir  string           `json:"pkg_dir"`
+	Groups  []SuggestedGroup `json:"groups"`
+	// 提案どおりに分割した場合にできる循環参照(なければ空)
+	Cycle []string `json:"cycle,omitempty"`
+	// split コマンドにそのまま渡せる引数
+	// split は循環参照や非公開シンボルの参照が残る分割を拒否するため、その場合は空
+	Command string `json:"command,omitempty"`
+}
+
+// SuggestedGroup は分割後の1パッケージ分のファイルと宣言
+type SuggestedGroup struct {
+	Name string `json:"name"`
+	// 移動先のディレクトリ。元のパッケージに残るグループは空
+	Dir   string   `json:"dir,omitempty"`
+	Files []string `json:"files"`
+	Decls []string `json:"decls"`
+	// 他のグループとの間の参照数
+	References int `json:"references"`
+	// 他のグループから参照されるため公開が必要な、このグループの非公開シンボル
+	Exposed []string `json:"exposed"`
+}
+
+// AnalyzePackage は pkgDir のパッケージのシンボル間の依存関係を調べ、
+// 結合の弱いファイルの集まりを groups 個に分ける分割案を返す
+func AnalyzePackage(workDir, pkgDir string, groups int, buildFlags []string) (*SplitSuggestion, error) {
+	if groups < 2 {
+		return nil, fmt.Errorf("number of groups must be at least 2: %d", groups)
+	}
+	fs := token.NewFileSet()
+	pkgs, err := loadPackages(fs, workDir, buildFlags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	pkg := findPackageByDir(fs, pkgs, pkgDir)
+	if pkg == nil {
+		return nil, fmt.Errorf("package not found in %s", pkgDir)
+	}
+
+	// ファイルごとのパッケージレベルの宣言
+	var files []string
+	decls := map[string][]string{}
+	for _, file := range pkg.Syntax {
+		filename := fs.Position(file.Pos()).Filename
+		files = append(files, filename)
+		decls[filename] = nil
+	}
+	sort.Strings(files)
+	for ident, obj := range pkg.TypesInfo.Defs {
+		if obj == nil || obj.Pkg() != pkg.Types {
+			continue
+		}
+		name := ""
+		if obj.Parent() == pkg.Types.Scope() {
+			name = obj.Name()
+		} else if fn, ok := obj.(*types.Func); ok {
+			// func _() {} はパッケージのスコープに入らないが、レシーバもない
+			if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+				if named := namedOf(recv.Type()); named != nil {
+					name = named.Obj().Name() + "." + fn.Name()
+				}
+			}
+		}
+		if name == "" || name == "_" {
+			continue
+		}
+		filename := fs.Position(ident.Pos()).Filename
+		if _, ok := decls[filename]; ok {
+			decls[filename] = append(decls[filename], name)
+		}
+	}
+
+	// ファイル間の参照
+	type ref struct {
+		from, to string
+		obj      types.Object
+	}
+	var refs []ref
+	weight := map[[2]string]int{}
+	for _, file := range pkg.Syntax {
+		from := fs.Position(file.Pos()).Filename
+		ast.Inspect(file, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj := pkg.TypesInfo.Uses[ident]
+			if obj == nil || obj.Pkg() != pkg.Types {
+				return true
+			}
+			to := fs.Position(obj.Pos()).Filename
+			if _, ok := decls[to]; !ok || to == from {
+				return true
+			}
+			refs = append(refs, ref{from: from, to: to, obj: obj})
+			weight[filePair(from, to)]++
+			return true
+		})
+	}
+
+	clusters := clusterFiles(files, decls, weight, groups)
+
+	clusterOf := map[string]int{}
+	for i, c := range clusters {
+		for _, f := range c {
+			clusterOf[f] = i
+		}
+	}
+
+	// 宣言数が最も多いグループを元のパッケージに残す
+	stay := 0
+	for i, c := range clusters {
+		if declCount(c, decls) > declCount(clusters[stay], decls) {
+			stay = i
+		}
+	}
+
+	names := make([]string, len(clusters))
+	usedNames := map[string]bool{pkg.Name: true}
+	for i, c := range clusters {
+		if i == stay {
+			names[i] = pkg.Name
+			continue
+		}
+		names[i] = suggestGroupName(c, usedNames)
+	}
+
+	exposed := make([]map[string]bool, len(clusters))
+	references := make([]int, len(clusters))
+	for i := range clusters {
+		exposed[i] = map[string]bool{}
+	}
+	edges := map[string]map[string]bool{}
+	for _, r := range refs {
+		from, to := clusterOf[r.from], clusterOf[r.to]
+		if from == to {
+			continue
+		}
+		references[from]++
+		references[to]++
+		// 公開が必要なのは宣言しているグループ
+		if !r.obj.Exported() {
+			exposed[to][r.obj.Name()] = true
+		}
+		if edges[names[from]] == nil {
+			edges[names[from]] = map[string]bool{}
+		}
+		edges[names[from]][names[to]] = true
+	}
+
+	suggestion := &SplitSuggestion{PkgPath: pkg.PkgPath, PkgDir: pkgDir, Cycle: findCycle(edges)}
+	var mappings []string
+	for i, c := range clusters {
+		group := SuggestedGroup{
+			Name:       names[i],
+			References: references[i],
+			Exposed:    sortedKeys(exposed[i]),
+		}
+		for _, f := range c {
+			group.Files = append(group.Files, filepath.Base(f))
+			group.Decls = append(group.Decls, decls[f]...)
+		}
+		sort.Strings(group.Decls)
+		if i != stay {
+			group.Dir = filepath.Join(pkgDir, names[i])
+			rel, err := filepath.Rel(workDir, group.Dir)
+			if err != nil {
+				rel = group.Dir
+			}
+			for _, f := range group.Files {
+				mappings = append(mappings, fmt.Sprintf("--map '%s=%s'", f, filepath.ToSlash(rel)))
+			}
+		}
+		suggestion.Groups = append(suggestion.Groups, group)
+	}
+
+	relPkg, err := filepath.Rel(workDir, pkgDir)
+	if err != nil {
+		relPkg = pkgDir
+	}
+	if len(suggestion.Cycle) > 0 {
+		return suggestion, nil
+	}
+	for _, group := range suggestion.Groups {
+		if len(group.Exposed) > 0 {
+			return suggestion, nil
+		}
+	}
+	suggestion.Command = fmt.Sprintf("pachanger split --pkg ./%s %s", filepath.ToSlash(relPkg), strings.Join(mappings, " "))
+	return suggestion, nil
+}
+
+func filePair(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+func declCount(files []string, decls map[string][]string) int {
+	n := 0
+	for _, f := range files {
+		n += max(1, len(decls[f]))
+	}
+	return n
+}
+
+// clusterFiles はファイル間の参照数を宣言数で正規化した結合度が高い順に
+// ファイルをまとめていき、groups 個のグループに分ける(平均連結法)
+// split はファイル単位で移動するため、宣言ではなくファイルをまとめる
+func clusterFiles(files []string, decls map[string][]string, weight map[[2]string]int, groups int) [][]string {
+	clusters := make([][]string, 0, len(files))
+	for _, f := range files {
+		clusters = append(clusters, []string{f})
+	}
+
+	for len(clusters) > groups {
+		bestI, bestJ := 0, 1
+		bestScore := -1.0
+		for i := 0; i < len(clusters); i++ {
+			for j := i + 1; j < len(clusters); j++ {
+				w := 0
+				for _, a := range clusters[i] {
+					for _, b := range clusters[j] {
+						w += weight[filePair(a, b)]
+					}
+				}
+				score := float64(w) / float64(declCount(clusters[i], decls)*declCount(clusters[j], decls))
+				if score > bestScore {
+					bestI, bestJ, bestScore = i, j, score
+				}
+			}
+		}
+		merged := append(append([]string{}, clusters[bestI]...), clusters[bestJ]...)
+		sort.Strings(merged)
+		clusters[bestI] = merged
+		clusters = append(clusters[:bestJ], clusters[bestJ+1:]...)
+	}
+	return clusters
+}
+
+// suggestGroupName はファイル名に共通する接頭辞からグループ名を決める
+func suggestGroupName(files []string, used map[string]bool) string {
+	prefix := ""
+	for i, f := range files {
+		base := strings.TrimSuffix(filepath.Base(f), ".go")
+		base, _, _ = strings.Cut(base, "_")
+		if i == 0 {
+			prefix = base
+			continue
+		}
+		for !strings.HasPrefix(base, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	prefix = strings.Trim(strings.ToLower(prefix), "-_.")
+	if prefix == "" || !token.IsIdentifier(prefix) {
+		prefix = "group"
+	}
+	name := prefix
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s%d", prefix, i)
+	}
+	used[name] = true
+	return name
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteText は分割案を人が読める形式で書き出す
+func (s *SplitSuggestion) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Suggested split of %s\n", s.PkgPath)
+	for _, g := range s.Groups {
+		if g.Dir == "" {
+			fmt.Fprintf(&b, "\n%s (stays)\n", g.Name)
+		} else {
+			fmt.Fprintf(&b, "\n%s -> %s\n", g.Name, g.Dir)
+		}
+		fmt.Fprintf(&b, "  files:      %s\n", strings.Join(g.Files, ", "))
+		fmt.Fprintf(&b, "  decls:      %s\n", strings.Join(g.Decls, ", "))
+		fmt.Fprintf(&b, "  references: %d\n", g.References)
+		fmt.Fprintf(&b, "  to expose:  %d", len(g.Exposed))
+		if len(g.Exposed) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(g.Exposed, ", "))
+		}
+		b.WriteString("\n")
+	}
+	if len(s.Cycle) > 0 {
+		fmt.Fprintf(&b, "\nwarning: this split creates an import cycle %s\n", strings.Join(s.Cycle, " -> "))
+	}
+	switch {
+	case s.Command != "":
+		fmt.Fprintf(&b, "\n%s\n", s.Command)
+	case len(s.Cycle) == 0:
+		b.WriteString("\nexpose the symbols listed above before running split\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON は分割案をJSONで書き出す
+func (s *SplitSuggestion) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
@@ -0,0 +1,67 @@
+package pachanger_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzePackage(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"model/user.go":       "package model\n\ntype User struct{ Name string }\n\nfunc NewUser() *User { return &User{} }\n",
+		"model/user_repo.go":  "package model\n\nfunc SaveUser(u *User) { _ = NewUser() }\n",
+		"model/order.go":      "package model\n\ntype Order struct{ ID int }\n\nfunc newOrder() Order { return Order{} }\n",
+		"model/order_item.go": "package model\n\ntype OrderItem struct{ Order Order }\n\nfunc NewOrderItem() OrderItem { return OrderItem{Order: newOrder()} }\n",
+	})
+
+	suggestion, err := pachanger.AnalyzePackage(workDir, filepath.Join(workDir, "model"), 2, nil)
+	assert.NoError(t, err)
+	assert.Len(t, suggestion.Groups, 2)
+
+	assert.Equal(t, "model", suggestion.Groups[0].Name)
+	assert.Equal(t, []string{"order.go", "order_item.go"}, suggestion.Groups[0].Files)
+	assert.Empty(t, suggestion.Groups[0].Dir)
+	assert.Empty(t, suggestion.Groups[0].Exposed)
+
+	assert.Equal(t, "user", suggestion.Groups[1].Name)
+	assert.Equal(t, []string{"user.go", "user_repo.go"}, suggestion.Groups[1].Files)
+	assert.Equal(t, []string{"NewUser", "SaveUser", "User"}, suggestion.Groups[1].Decls)
+	assert.Equal(t, 0, suggestion.Groups[1].References)
+	assert.Empty(t, suggestion.Cycle)
+
+	assert.Equal(t, "pachanger split --pkg ./model --map 'user.go=model/user' --map 'user_repo.go=model/user'", suggestion.Command)
+}
+
+func TestAnalyzePackageBlankFunc(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"model/user.go":  "package model\n\ntype User struct{ Name string }\n\nfunc (u User) Greet() string { return u.Name }\n\nfunc _() {}\n",
+		"model/order.go": "package model\n\ntype Order struct{ ID int }\n",
+	})
+
+	suggestion, err := pachanger.AnalyzePackage(workDir, filepath.Join(workDir, "model"), 2, nil)
+	assert.NoError(t, err)
+	var decls []string
+	for _, group := range suggestion.Groups {
+		decls = append(decls, group.Decls...)
+	}
+	assert.Contains(t, decls, "User.Greet")
+	assert.NotContains(t, decls, "_")
+}
+
+func TestAnalyzePackageExposed(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"model/a.go": "package model\n\nfunc helper() int { return 1 }\n",
+		"model/b.go": "package model\n\nfunc B() int { return helper() }\n",
+	})
+
+	suggestion, err := pachanger.AnalyzePackage(workDir, filepath.Join(workDir, "model"), 2, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.go"}, suggestion.Groups[0].Files)
+	assert.Equal(t, []string{"helper"}, suggestion.Groups[0].Exposed)
+	assert.Equal(t, []string{"b.go"}, suggestion.Groups[1].Files)
+	assert.Empty(t, suggestion.Groups[1].Exposed)
+	// split は非公開シンボルの参照が残る分割を拒否するため、コマンドは出さない
+	assert.Empty(t, suggestion.Command)
+}
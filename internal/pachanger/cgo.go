@@ -0,0 +1,336 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// cSourceExts はパッケージのディレクトリで go build がコンパイルする C などのソースファイルの拡張子
+var cSourceExts = []string{".c", ".cc", ".cpp", ".cxx", ".m", ".s", ".S"}
+
+// reparseCgoPackages は cgo を使うパッケージの構文木を元のファイルから作り直す
+// go/packages は cgo で変換した後のファイルを構文木にするため、そのまま書き出すと変換後のコードになってしまう
+// 元のファイルは import "C" を含むため、C の参照は型を検査せずに型情報を作る
+func reparseCgoPackages(fs *token.FileSet, pkgs []*packages.Package) {
+	parsed := map[string]*ast.File{}
+	for _, pkg := range pkgs {
+		if pkg.Types == nil || !slices.ContainsFunc(pkg.GoFiles, func(f string) bool { return !slices.Contains(pkg.CompiledGoFiles, f) }) {
+			continue
+		}
+		var files []*ast.File
+		for _, filename := range pkg.GoFiles {
+			file, ok := parsed[filename]
+			if !ok {
+				var err error
+				file, err = parser.ParseFile(fs, filename, nil, parser.ParseComments)
+				if err != nil {
+					debugf("failed to parse cgo file %s: %v", filename, err)
+					continue
+				}
+				parsed[filename] = file
+			}
+			files = append(files, file)
+		}
+
+		conf := &types.Config{
+			FakeImportC: true,
+			Importer: importerFunc(func(path string) (*types.Package, error) {
+				if path == "unsafe" {
+					return types.Unsafe, nil
+				}
+				if imported, ok := pkg.Imports[path]; ok && imported.Types != nil {
+					return imported.Types, nil
+				}
+				return nil, fmt.Errorf("package %s is not imported by %s", path, pkg.PkgPath)
+			}),
+			// C の型は分からないため、型エラーは無視する
+			Error: func(error) {},
+		}
+		info := &types.Info{
+			Types:      map[ast.Expr]types.TypeAndValue{},
+			Defs:       map[*ast.Ident]types.Object{},
+			Uses:       map[*ast.Ident]types.Object{},
+			Implicits:  map[ast.Node]types.Object{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+			Scopes:     map[ast.Node]*types.Scope{},
+			Instances:  map[*ast.Ident]types.Instance{},
+		}
+		typesPkg := types.NewPackage(pkg.PkgPath, pkg.Name)
+		_ = types.NewChecker(conf, fs, typesPkg, info).Files(files)
+
+		debugf("Reparsed cgo package %s", pkg.ID)
+		pkg.Syntax = files
+		pkg.Types = typesPkg
+		pkg.TypesInfo = info
+		pkg.CompiledGoFiles = pkg.GoFiles
+	}
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// cgoPreamble はファイルの import "C" の直前にあるプリアンブルを返す。cgo を使っていなければ nil を返す
+func cgoPreamble(file *ast.File) *ast.CommentGroup {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			if imp.Path.Value != `"C"` {
+				continue
+			}
+			if imp.Doc != nil {
+				return imp.Doc
+			}
+			if !gen.Lparen.IsValid() && gen.Doc != nil {
+				return gen.Doc
+			}
+			return &ast.CommentGroup{}
+		}
+	}
+	return nil
+}
+
+// prepareCgoMove は cgo を使うファイルを移動できるか確かめ、プリアンブルを移動先に合わせて書き換える
+// 移動元に残る C のソースで定義された関数を呼んでいる場合や、C のソースから呼ばれる関数を export している場合はエラーにする
+func (t *Transformer) prepareCgoMove(target, output string, file *ast.File) error {
+	preamble := cgoPreamble(file)
+	srcDir, outDir := filepath.Dir(target), filepath.Dir(output)
+	if preamble == nil || srcDir == outDir {
+		return nil
+	}
+
+	cSources, err := cSourcesInDir(srcDir)
+	if err != nil {
+		return err
+	}
+	// C の関数の定義は移動元のディレクトリに残るため、Go のコードと別のパッケージになってしまう
+	for _, name := range cgoReferences(file) {
+		definition := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\s*\([^;{]*\)\s*\{`)
+		for source, content := range cSources {
+			if definition.MatchString(content) {
+				return fmt.Errorf("cannot move %s: it calls C function %s defined in %s, which stays in %s", target, name, source, srcDir)
+			}
+		}
+	}
+	for _, name := range cgoExports(file) {
+		for source, content := range cSources {
+			if regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).MatchString(content) {
+				return fmt.Errorf("cannot move %s: exported function %s is used by %s, which stays in %s", target, name, source, srcDir)
+			}
+		}
+	}
+
+	// #cgo の指定はパッケージ全体に効くため、移動元に残るファイルの指定を移動するファイルにも加える
+	own := cgoDirectives(preamble)
+	var missing, stayingDirectives []string
+	staying := false
+	// 追加する順番が実行ごとに変わらないよう、ファイル名の順に調べる
+	files := t.filesInDir(srcDir)
+	for _, filename := range slices.Sorted(maps.Keys(files)) {
+		otherPreamble := cgoPreamble(files[filename])
+		if filename == target || otherPreamble == nil {
+			continue
+		}
+		if _, moved := t.movedPath(filename); moved {
+			continue
+		}
+		staying = true
+		for _, directive := range cgoDirectives(otherPreamble) {
+			stayingDirectives = append(stayingDirectives, directive)
+			if !slices.Contains(own, directive) && !slices.Contains(missing, directive) {
+				missing = append(missing, directive)
+			}
+		}
+	}
+	// 残るファイルのどれにも書かれていない指定は、移動すると元のパッケージから失われる
+	for _, c := range preamble.List {
+		for _, directive := range cgoDirectives(&ast.CommentGroup{List: []*ast.Comment{c}}) {
+			if staying && !slices.Contains(stayingDirectives, directive) {
+				t.warnDirective(target, c, fmt.Sprintf("cgo files staying in %s lose this directive: %s", srcDir, directive))
+			}
+		}
+	}
+	// プリアンブルがない import "C" には指定を書き足す場所がない
+	if len(missing) > 0 && len(preamble.List) == 0 {
+		return fmt.Errorf("cannot move %s: it has no cgo preamble to carry %s from the files staying in %s; add them above import \"C\"", target, strings.Join(missing, ", "), srcDir)
+	}
+
+	for _, c := range preamble.List {
+		lines := strings.Split(c.Text, "\n")
+		for i, line := range lines {
+			lines[i] = rewriteCgoLine(line, srcDir, outDir)
+		}
+		c.Text = strings.Join(lines, "\n")
+	}
+	if len(missing) > 0 {
+		var added []string
+		for _, directive := range missing {
+			added = append(added, rewriteCgoLine(directive, srcDir, outDir))
+		}
+		last := preamble.List[len(preamble.List)-1]
+		original := last.Text
+		if body, ok := strings.CutSuffix(last.Text, "*/"); ok {
+			last.Text = strings.TrimRight(body, "\n") + "\n" + strings.Join(added, "\n") + "\n*/"
+		} else {
+			last.Text += "\n// " + strings.Join(added, "\n// ")
+		}
+		if err := t.insertLines(last.Pos(), len(original), strings.Count(last.Text, "\n")-strings.Count(original, "\n")); err != nil {
+			return fmt.Errorf("cannot add cgo directives to %s: %w", target, err)
+		}
+		debugf("Add cgo directives %v to %s", added, target)
+	}
+	return nil
+}
+
+// insertLines はコメントに n 行を足したときに、コメントより後ろの位置の行番号を n だけ後ろにずらす
+// 位置情報の行番号がずれたままだと、プリンタがコメントの直後の import "C" を同じ行に出力してしまう
+// コメントの元の範囲 [pos, pos+size) に行の始まりを足すため、コメントより前の行番号は変わらない
+func (t *Transformer) insertLines(pos token.Pos, size, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	file := t.fs.File(pos)
+	start := file.Offset(pos)
+	lines := file.Lines()
+	for offset := start + 1; offset < start+size && n > 0; offset++ {
+		i, found := slices.BinarySearch(lines, offset)
+		if found {
+			continue
+		}
+		lines = slices.Insert(lines, i, offset)
+		n--
+	}
+	if n > 0 || !file.SetLines(lines) {
+		return fmt.Errorf("the preamble is too short to add lines to")
+	}
+	return nil
+}
+
+var cgoIncludeLine = regexp.MustCompile(`^(\s*#\s*include\s*")([^"]+)(".*)$`)
+
+// rewriteCgoLine はプリアンブルの1行にある #cgo の -I/-L と #include "..." の相対パスを移動先からのパスにする
+func rewriteCgoLine(line, srcDir, outDir string) string {
+	prefix := ""
+	body := line
+	if rest, ok := strings.CutPrefix(strings.TrimLeft(line, " \t"), "//"); ok {
+		prefix = line[:len(line)-len(rest)]
+		body = rest
+	}
+
+	if m := cgoIncludeLine.FindStringSubmatch(body); m != nil {
+		abs := filepath.Join(srcDir, filepath.FromSlash(m[2]))
+		if _, err := os.Stat(abs); err == nil && !filepath.IsAbs(m[2]) {
+			return prefix + m[1] + relPath(outDir, abs) + m[3]
+		}
+		return line
+	}
+
+	trimmed := strings.TrimLeft(body, " \t")
+	if !strings.HasPrefix(trimmed, "#cgo ") {
+		return line
+	}
+	words := strings.Fields(trimmed)
+	for i, word := range words {
+		for _, flag := range []string{"-I", "-L"} {
+			if value, ok := strings.CutPrefix(word, flag); ok && value != "" {
+				words[i] = flag + rewriteCgoPath(value, srcDir, outDir)
+			} else if word == flag && i+1 < len(words) {
+				words[i+1] = rewriteCgoPath(words[i+1], srcDir, outDir)
+			}
+		}
+	}
+	if slices.Equal(words, strings.Fields(trimmed)) {
+		return line
+	}
+	return prefix + body[:len(body)-len(trimmed)] + strings.Join(words, " ")
+}
+
+// rewriteCgoPath は #cgo のフラグに書かれたパスを移動先のディレクトリからのパスにする
+func rewriteCgoPath(value, srcDir, outDir string) string {
+	if rest, ok := strings.CutPrefix(value, "${SRCDIR}"); ok {
+		return "${SRCDIR}/" + relPath(outDir, filepath.Join(srcDir, filepath.FromSlash(rest)))
+	}
+	if filepath.IsAbs(value) || strings.Contains(value, "$") {
+		return value
+	}
+	return relPath(outDir, filepath.Join(srcDir, filepath.FromSlash(value)))
+}
+
+// cgoDirectives はプリアンブルの #cgo の行を空白を詰めて返す
+func cgoDirectives(preamble *ast.CommentGroup) []string {
+	var directives []string
+	for _, c := range preamble.List {
+		for _, line := range strings.Split(c.Text, "\n") {
+			line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "//"))
+			line = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "/*"), "*/"))
+			if strings.HasPrefix(line, "#cgo ") {
+				directives = append(directives, strings.Join(strings.Fields(line), " "))
+			}
+		}
+	}
+	return directives
+}
+
+// cgoReferences はファイルで参照している C.xxx の名前を返す
+func cgoReferences(file *ast.File) []string {
+	var names []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == "C" && !slices.Contains(names, sel.Sel.Name) {
+				names = append(names, sel.Sel.Name)
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// cgoExports は //export で C に公開している関数の名前を返す
+func cgoExports(file *ast.File) []string {
+	var names []string
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if name, ok := strings.CutPrefix(c.Text, "//export "); ok {
+				names = append(names, strings.TrimSpace(name))
+			}
+		}
+	}
+	return names
+}
+
+// cSourcesInDir はディレクトリにある C などのソースファイルの内容を返す
+func cSourcesInDir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	sources := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !slices.Contains(cSourceExts, filepath.Ext(entry.Name())) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+		sources[filepath.Join(dir, entry.Name())] = string(content)
+	}
+	return sources, nil
+}
@@ -0,0 +1,93 @@
+package pachanger_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgo(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc is not installed")
+	}
+	files := map[string]string{
+		"native/add.go": "package native\n\n" +
+			"/*\n#cgo CFLAGS: -I${SRCDIR}/include\n#include \"add.h\"\n#include \"local.h\"\n*/\n" +
+			"import \"C\"\n\n" +
+			"// Add は [Sub] と対になる\n" +
+			"func Add(a, b int) int { return int(C.add(C.int(a), C.int(b))) + Sub(0, 0) }\n",
+		"native/flags.go":       "package native\n\n// #cgo CFLAGS: -DLOCAL=1\nimport \"C\"\n\nfunc Sub(a, b int) int { return a - b }\n",
+		"native/helper.go":      "package native\n\n// int helper(int x);\nimport \"C\"\n\nfunc Helper(x int) int { return int(C.helper(C.int(x))) }\n",
+		"native/helper.c":       "int helper(int x) {\n\treturn x * 2;\n}\n",
+		"native/local.go":       "package native\n\n// #cgo CFLAGS: -DLOCAL=1\nimport \"C\"\n\nfunc Local() int { return int(C.int(1)) }\n",
+		"native/plain.go":       "package native\n\nimport \"C\"\n\nfunc Plain() int { return int(C.int(2)) }\n",
+		"native/local.h":        "#define LOCAL_VALUE 1\n",
+		"native/include/add.h":  "static inline int add(int a, int b) { return a + b; }\n",
+		"app/app.go":            "package app\n\nimport \"example.com/mod/native\"\n\nvar N = native.Add(1, 2)\n",
+		"native/native_test.go": "package native\n\nimport \"testing\"\n\nfunc TestSub(t *testing.T) { _ = Sub(1, 1) }\n",
+	}
+
+	t.Run("プリアンブルのパスを書き換えて移動する場合", func(t *testing.T) {
+		workDir := writeModule(t, files)
+		transformer, err := pachanger.NewTransformer(workDir, "add", "", "", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, os.MkdirAll(filepath.Join(workDir, "native/add"), 0755))
+		assert.NoError(t, transformer.TransformSymbolsInTargetFile(filepath.Join(workDir, "native/add.go"), filepath.Join(workDir, "native/add/add.go")))
+		for _, f := range []string{"native/flags.go", "native/helper.go", "native/native_test.go", "app/app.go"} {
+			assert.NoError(t, transformer.TransformSymbolsInOtherFile(filepath.Join(workDir, f), filepath.Join(workDir, f)))
+		}
+		assert.NoError(t, transformer.Dump())
+		assert.NoError(t, os.Remove(filepath.Join(workDir, "native/add.go")))
+
+		b, err := os.ReadFile(filepath.Join(workDir, "native/add/add.go"))
+		assert.NoError(t, err)
+		moved := string(b)
+		assert.Contains(t, moved, "#cgo CFLAGS: -I${SRCDIR}/../include\n")
+		assert.Contains(t, moved, "#include \"add.h\"\n")
+		assert.Contains(t, moved, "#include \"../local.h\"\n")
+		// パッケージ全体に効いていた指定を引き継ぐ
+		assert.Contains(t, moved, "#cgo CFLAGS: -DLOCAL=1\n*/\nimport \"C\"\n")
+		assert.Contains(t, moved, "C.add(C.int(a), C.int(b))")
+		assert.Contains(t, moved, "native.Sub(0, 0)")
+		assert.Contains(t, moved, "// Add は [native.Sub] と対になる\n")
+		assert.NotContains(t, moved, "_Cfunc_")
+		// 残るファイルにもある -DLOCAL=1 は失われないため、-I の指定だけを警告する
+		warnings := transformer.DirectiveWarnings()
+		if assert.Len(t, warnings, 1) {
+			assert.Contains(t, warnings[0].Reason, "lose this directive: #cgo CFLAGS: -I${SRCDIR}/include")
+		}
+
+		cmd := exec.Command("go", "build", "./...")
+		cmd.Dir = workDir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	})
+
+	t.Run("C のソースと分かれてしまう場合", func(t *testing.T) {
+		workDir := writeModule(t, files)
+		transformer, err := pachanger.NewTransformer(workDir, "helper", "", "", nil)
+		assert.NoError(t, err)
+		err = transformer.TransformSymbolsInTargetFile(filepath.Join(workDir, "native/helper.go"), filepath.Join(workDir, "native/helper/helper.go"))
+		assert.ErrorContains(t, err, "it calls C function helper defined in "+filepath.Join(workDir, "native/helper.c"))
+	})
+
+	t.Run("残るファイルにも同じ指定がある場合", func(t *testing.T) {
+		workDir := writeModule(t, files)
+		transformer, err := pachanger.NewTransformer(workDir, "local", "", "", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, transformer.TransformSymbolsInTargetFile(filepath.Join(workDir, "native/local.go"), filepath.Join(workDir, "native/local/local.go")))
+		assert.Empty(t, transformer.DirectiveWarnings())
+	})
+
+	t.Run("プリアンブルがないファイルに指定を引き継げない場合", func(t *testing.T) {
+		workDir := writeModule(t, files)
+		transformer, err := pachanger.NewTransformer(workDir, "plain", "", "", nil)
+		assert.NoError(t, err)
+		err = transformer.TransformSymbolsInTargetFile(filepath.Join(workDir, "native/plain.go"), filepath.Join(workDir, "native/plain/plain.go"))
+		assert.ErrorContains(t, err, "has no cgo preamble to carry #cgo CFLAGS: -I${SRCDIR}/include, #cgo CFLAGS: -DLOCAL=1 from")
+	})
+}
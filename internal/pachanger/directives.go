@@ -0,0 +1,290 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// DirectiveWarning は安全に書き換えられなかったディレクティブ
+type DirectiveWarning struct {
+	File      string
+	Line      int
+	Directive string
+	Reason    string
+}
+
+func (w DirectiveWarning) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", w.File, w.Line, w.Directive, w.Reason)
+}
+
+// DirectiveWarnings は書き換えられなかったディレクティブの一覧を返す
+func (t *Transformer) DirectiveWarnings() []DirectiveWarning {
+	t.skippedMutex.Lock()
+	defer t.skippedMutex.Unlock()
+	warnings := make([]DirectiveWarning, len(t.directiveWarnings))
+	copy(warnings, t.directiveWarnings)
+	return warnings
+}
+
+func (t *Transformer) warnDirective(filename string, c *ast.Comment, reason string) {
+	warning := DirectiveWarning{
+		File:      filename,
+		Line:      t.fs.Position(c.Pos()).Line,
+		Directive: c.Text,
+		Reason:    reason,
+	}
+	t.skippedMutex.Lock()
+	defer t.skippedMutex.Unlock()
+	// 複数のターゲットを処理すると同じディレクティブを何度も調べるため、重複して記録しない
+	if slices.Contains(t.directiveWarnings, warning) {
+		return
+	}
+	t.directiveWarnings = append(t.directiveWarnings, warning)
+}
+
+// declaredNames はターゲットファイルでパッケージレベルに宣言された、非公開のものも含むシンボル名を返す
+// go:linkname は非公開のシンボルを参照することが多いため、filterDefSymbols とは別に集める
+func (t *Transformer) declaredNames(pkg *packages.Package, absTargetFile string) map[string]bool {
+	names := map[string]bool{}
+	for _, d := range pkg.TypesInfo.Defs {
+		if d != nil && d.Pkg() != nil && d.Parent() == d.Pkg().Scope() && t.fs.Position(d.Pos()).Filename == absTargetFile {
+			names[d.Name()] = true
+		}
+	}
+	return names
+}
+
+// rewriteDirectives は go:linkname と go:generate のディレクティブを移動に合わせて書き換える
+// 書き換えられないディレクティブは DirectiveWarnings で報告する。書き換えた場合は true を返す
+func (t *Transformer) rewriteDirectives(filename string, file *ast.File, isTarget bool) bool {
+	modified := false
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			directive, args, ok := strings.Cut(strings.TrimPrefix(c.Text, "//"), " ")
+			if !ok || !strings.HasPrefix(c.Text, "//go:") {
+				continue
+			}
+			text := c.Text
+			switch directive {
+			case "go:linkname":
+				text = t.rewriteLinkname(filename, c, args, isTarget)
+			case "go:generate":
+				text = t.rewriteGenerate(filename, c, args, file, isTarget)
+			case "go:build", "go:embed":
+				// ビルド制約と埋め込むファイルは import path を含まない
+			default:
+				if strings.Contains(args, t.oldPkgPath) {
+					t.warnDirective(filename, c, fmt.Sprintf("mentions %s and was not rewritten", t.oldPkgPath))
+				}
+			}
+			if text != c.Text {
+				debugf("Update directive %q -> %q", c.Text, text)
+				c.Text = text
+				modified = true
+			}
+		}
+	}
+	return modified
+}
+
+// rewriteLinkname は "//go:linkname local importpath.name" の参照先が移動したシンボルであれば、新しいimport pathにする
+func (t *Transformer) rewriteLinkname(filename string, c *ast.Comment, args string, isTarget bool) string {
+	fields := strings.Fields(args)
+	if len(fields) == 1 {
+		if isTarget {
+			t.warnDirective(filename, c, fmt.Sprintf("the symbol was pushed as %s.%s and is now %s.%s; update the packages that pull it", t.oldPkgPath, fields[0], t.newPkgPath, fields[0]))
+		}
+		return c.Text
+	}
+	if len(fields) != 2 {
+		return c.Text
+	}
+
+	remote := fields[1]
+	pkgPath, name, ok := splitLinkname(remote)
+	if !ok || pkgPath != t.oldPkgPath {
+		return c.Text
+	}
+	// メソッドは "(*T).M" や "T.M" の形で書かれるため、レシーバーの型名で判定する
+	sym := strings.TrimPrefix(name, "(*")
+	if i := strings.IndexAny(sym, ".)"); i >= 0 {
+		sym = sym[:i]
+	}
+	if !t.targetDecls[sym] {
+		return c.Text
+	}
+	if t.targetSymbols[sym] {
+		name = strings.Replace(name, sym, t.transformSymbolName(sym), 1)
+	}
+	return fmt.Sprintf("//go:linkname %s %s.%s", fields[0], t.newPkgPath, name)
+}
+
+// splitLinkname は go:linkname の参照先をimport pathとシンボル名に分ける
+func splitLinkname(remote string) (string, string, bool) {
+	slash := strings.LastIndex(remote, "/")
+	dot := strings.Index(remote[slash+1:], ".")
+	if dot < 0 {
+		return "", "", false
+	}
+	dot += slash + 1
+	return remote[:dot], remote[dot+1:], true
+}
+
+// generateDestinationFlags は go:generate で生成先を指定するフラグ
+var generateDestinationFlags = []string{"destination", "output", "out", "o"}
+
+// rewriteGenerate は go:generate の引数を書き換える
+// 移動するファイルでは、移動元に残るファイルへの相対パスを移動先からのパスにし、
+// 移動先のディレクトリに生成するコードの -package を新しいパッケージ名にする
+// 他のファイルでは、移動するファイルへの相対パスを移動先へのパスにする
+func (t *Transformer) rewriteGenerate(filename string, c *ast.Comment, args string, file *ast.File, isTarget bool) string {
+	dir := filepath.Dir(filename)
+	if !isTarget {
+		dir = t.finalDir(filename, false)
+	}
+	if strings.Contains(args, `"`) {
+		if isTarget && dir != filepath.Dir(t.outputFile) {
+			t.warnDirective(filename, c, "quoted arguments are not rewritten; check the relative paths")
+		}
+		return c.Text
+	}
+
+	var embedded []string
+	if isTarget {
+		embedded, _ = embeddedFiles(dir, file)
+	}
+	rewritePath := func(p string, destination bool) string {
+		rewritten := t.rewriteGeneratePath(dir, p, destination, embedded, isTarget)
+		// "./gen.sh" のようにコマンドとして実行するパスは "./" を残す
+		if rewritten != p && strings.HasPrefix(p, "./") && !strings.HasPrefix(rewritten, "../") {
+			rewritten = "./" + rewritten
+		}
+		return rewritten
+	}
+
+	words := strings.Fields(args)
+	// 生成先が移動先のディレクトリになるか。生成先の指定がなければ移動先に生成する
+	generatesBeside := true
+	packageIndex := -1
+	for i := 0; i < len(words); i++ {
+		flag, value, hasValue := strings.Cut(strings.TrimLeft(words[i], "-"), "=")
+		if !strings.HasPrefix(words[i], "-") {
+			words[i] = rewritePath(words[i], false)
+			continue
+		}
+		isDestination := slices.Contains(generateDestinationFlags, flag)
+		if !hasValue {
+			if (isDestination || flag == "package" || flag == "source") && i+1 < len(words) {
+				i++
+				value = words[i]
+			} else {
+				continue
+			}
+		}
+		switch {
+		case flag == "package":
+			packageIndex = i
+			continue
+		case isDestination:
+			if isTarget && filepath.Dir(filepath.Join(dir, filepath.FromSlash(value))) != dir {
+				generatesBeside = false
+			}
+		}
+		value = rewritePath(value, isDestination)
+		if hasValue {
+			words[i] = words[i][:strings.Index(words[i], "=")+1] + value
+		} else {
+			words[i] = value
+		}
+	}
+
+	if isTarget && packageIndex >= 0 {
+		key, value, hasValue := strings.Cut(words[packageIndex], "=")
+		if !hasValue {
+			value = key
+		}
+		if value == t.oldPkg && generatesBeside {
+			if hasValue {
+				words[packageIndex] = key + "=" + t.newPkg
+			} else {
+				words[packageIndex] = t.newPkg
+			}
+		}
+	}
+	// 書き換えていなければ元の空白を保つ
+	if slices.Equal(words, strings.Fields(args)) {
+		return c.Text
+	}
+	return "//go:generate " + strings.Join(words, " ")
+}
+
+// rewriteGeneratePath は go:generate の引数のうち、移動によって指す先が変わる相対パスを書き換える
+// dir はディレクティブを書いたファイルの移動前のディレクトリ、ターゲットファイル以外では移動後のディレクトリ
+func (t *Transformer) rewriteGeneratePath(dir, p string, destination bool, embedded []string, isTarget bool) string {
+	if p == "" || filepath.IsAbs(p) || strings.Contains(p, "$") {
+		return p
+	}
+	// "." や "./..." はパッケージのディレクトリを指すため、移動先でもそのまま移動先のパッケージを指す
+	if filepath.Clean(filepath.FromSlash(p)) == "." || p == "./..." {
+		return p
+	}
+	abs := filepath.Join(dir, filepath.FromSlash(p))
+	baseDir := dir
+	if isTarget {
+		baseDir = filepath.Dir(t.outputFile)
+	}
+	if out, ok := t.movedPath(abs); ok {
+		return relPath(baseDir, out)
+	}
+	if baseDir == dir {
+		return p
+	}
+	// 移動元のディレクトリに生成していたコードは移動先のディレクトリに生成する
+	if destination && filepath.Dir(abs) == dir {
+		return p
+	}
+	if slices.Contains(embedded, filepath.Clean(filepath.FromSlash(p))) {
+		return p
+	}
+	if _, err := os.Stat(abs); err != nil && !destination {
+		return p
+	}
+	return relPath(baseDir, abs)
+}
+
+// movedPath は path が移動するファイルであれば移動先のパスを返す
+func (t *Transformer) movedPath(path string) (string, bool) {
+	if path == t.targetFile {
+		return t.outputFile, true
+	}
+	if d := t.getDoneFile(path); d != nil && d.output != path {
+		return d.output, true
+	}
+	return "", false
+}
+
+// finalDir はファイルの出力先のディレクトリを返す。先行ターゲットで移動したファイルは移動先になる
+func (t *Transformer) finalDir(filename string, isTarget bool) string {
+	if isTarget {
+		return filepath.Dir(t.outputFile)
+	}
+	if d := t.getDoneFile(filename); d != nil {
+		return filepath.Dir(d.output)
+	}
+	return filepath.Dir(filename)
+}
+
+// relPath は base から target への相対パスを "/" 区切りで返す
+func relPath(base, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return target
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,60 @@
+package pachanger_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteDirectives(t *testing.T) {
+	files := map[string]string{
+		"model/user.go": "package model\n\n" +
+			"//go:generate mockgen -source=user.go -destination=mock_user.go -package=model\n" +
+			"//go:generate mockgen -source user.go -destination ../mocks/user.go -package model\n" +
+			"//go:generate ./gen.sh schema.json\n\n" +
+			"type User interface{ Name() string }\n\n" +
+			"func now() int64 { return 0 }\n\n" +
+			"//go:linkname pushed\n" +
+			"func pushed() {}\n",
+		"model/gen.sh":      "#!/bin/sh\n",
+		"model/schema.json": "{}\n",
+		"model/base.go":     "package model\n\ntype Base struct{}\n",
+		"app/app.go": "package app\n\n" +
+			"import _ \"unsafe\"\n\n" +
+			"//go:generate mockgen -source=../model/user.go -destination=mock_user.go\n\n" +
+			"//go:linkname modelNow example.com/mod/model.now\n" +
+			"func modelNow() int64\n",
+		"app/app.s": "",
+	}
+
+	_, transformer, read := moveAndRead(t, files, moveConfig{}, "model/user.go", "model/user/user.go", "model/base.go", "app/app.go")
+	user := read("model/user/user.go")
+	assert.Contains(t, user, "//go:generate mockgen -source=user.go -destination=mock_user.go -package=user\n")
+	assert.Contains(t, user, "//go:generate mockgen -source user.go -destination ../../mocks/user.go -package model\n")
+	assert.Contains(t, user, "//go:generate ../gen.sh ../schema.json\n")
+
+	app := read("app/app.go")
+	assert.Contains(t, app, "//go:generate mockgen -source=../model/user/user.go -destination=mock_user.go\n")
+	assert.Contains(t, app, "//go:linkname modelNow example.com/mod/model/user.now\n")
+
+	warnings := transformer.DirectiveWarnings()
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, "//go:linkname pushed", warnings[0].Directive)
+	}
+}
+
+func TestRewriteGeneratePackageDir(t *testing.T) {
+	files := map[string]string{
+		"model/kind.go": "package model\n\n" +
+			"//go:generate stringer -type=Kind .\n" +
+			"//go:generate stringer -type=Kind -output=kind_string.go ./...\n\n" +
+			"type Kind int\n",
+		"model/base.go": "package model\n\ntype Base struct{}\n",
+	}
+
+	_, transformer, read := moveAndRead(t, files, moveConfig{}, "model/kind.go", "model/kind/kind.go", "model/base.go")
+	kind := read("model/kind/kind.go")
+	assert.Contains(t, kind, "//go:generate stringer -type=Kind .\n")
+	assert.Contains(t, kind, "//go:generate stringer -type=Kind -output=kind_string.go ./...\n")
+	assert.Empty(t, transformer.DirectiveWarnings())
+}
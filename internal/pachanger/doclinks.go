@@ -0,0 +1,271 @@
+package pachanger
+
+import (
+	"go/ast"
+	"go/doc/comment"
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+// SetRewriteMentions はコメント中のドキュメントリンク以外の "oldpkg.Foo" のような記述も書き換えるようにする
+func (t *Transformer) SetRewriteMentions(rewriteMentions bool) {
+	t.rewriteMentions = rewriteMentions
+}
+
+// rewriteComments はファイルのコメント中で、移動または名前を変えたシンボルを指す
+// ドキュメントリンクを書き換える。書き換えた場合は true を返す
+func (t *Transformer) rewriteComments(file *ast.File, filePkgPath string, typesInfo *types.Info, isTarget bool) bool {
+	inOldPkg := !isTarget && filePkgPath == t.oldPkgPath
+	inNewPkg := isTarget || filePkgPath == t.newPkgPath
+
+	// ファイルの import から、パッケージ名と import path の対応を作る
+	importPaths := map[string]string{}
+	for _, spec := range file.Imports {
+		obj := typesInfo.Implicits[spec]
+		if spec.Name != nil {
+			obj = typesInfo.Defs[spec.Name]
+		}
+		if pkgName, ok := obj.(*types.PkgName); ok {
+			importPaths[pkgName.Name()] = pkgName.Imported().Path()
+		}
+	}
+
+	// 書き換え後のリンクで使う、移動先と移動元のパッケージの書き方
+	newQualifier := t.newPkgPath
+	if inNewPkg {
+		newQualifier = ""
+	} else if usesQualifier(file, t.newPkg) {
+		newQualifier = t.newPkg
+	}
+	oldQualifier := t.oldPkgPath
+	if usesQualifier(file, t.oldPkg) {
+		oldQualifier = t.oldPkg
+	}
+	qualify := func(qualifier, name string) string {
+		if qualifier == "" {
+			return name
+		}
+		return qualifier + "." + name
+	}
+
+	parser := &comment.Parser{
+		LookupPackage: func(name string) (string, bool) {
+			importPath, ok := importPaths[name]
+			return importPath, ok
+		},
+		LookupSym: func(recv, name string) bool {
+			if !isTarget && !inOldPkg {
+				return false
+			}
+			if recv != "" {
+				name = recv
+			}
+			return t.targetSymbols[name] || t.otherSymbols[name]
+		},
+	}
+
+	// 書き換え前のリンクの表記から書き換え後の表記への対応
+	replacements := map[string]string{}
+	for _, group := range file.Comments {
+		if group == cgoPreamble(file) {
+			continue
+		}
+		doc := parser.Parse(group.Text())
+		for _, link := range docLinks(doc.Content) {
+			sym, member := link.Name, ""
+			if link.Recv != "" {
+				sym, member = link.Recv, "."+link.Name
+			}
+			local := link.ImportPath == "" && (isTarget || inOldPkg)
+			var replaced string
+			switch {
+			case t.targetSymbols[sym] && (link.ImportPath == t.oldPkgPath || local && !isTarget):
+				replaced = qualify(newQualifier, t.transformSymbolName(sym)) + member
+			case t.targetSymbols[sym] && local && isTarget:
+				replaced = t.transformSymbolName(sym) + member
+			case t.otherSymbols[sym] && local && isTarget:
+				replaced = qualify(oldQualifier, sym) + member
+			default:
+				continue
+			}
+			original := plainText(link.Text)
+			if strings.HasPrefix(original, "*") {
+				replaced = "*" + replaced
+			}
+			if original != replaced {
+				replacements["["+original+"]"] = "[" + replaced + "]"
+			}
+		}
+	}
+
+	// "oldpkg.Foo" のような記述は、オプションが指定された場合のみ書き換える
+	var mention *regexp.Regexp
+	if t.rewriteMentions {
+		qualifiers := []string{regexp.QuoteMeta(t.oldPkgPath)}
+		for name, importPath := range importPaths {
+			if importPath == t.oldPkgPath {
+				qualifiers = append(qualifiers, regexp.QuoteMeta(name))
+			}
+		}
+		if isTarget || inOldPkg {
+			qualifiers = append(qualifiers, regexp.QuoteMeta(t.oldPkg))
+		}
+		mention = regexp.MustCompile(`(^|[^\w./])(` + strings.Join(qualifiers, "|") + `)\.([A-Za-z_]\w*)\b`)
+	}
+
+	modified := false
+	if t.rewriteMentions && isTarget {
+		modified = t.rewriteDocNames(file)
+	}
+	// cgo のプリアンブルは C のコードのため書き換えない
+	preamble := cgoPreamble(file)
+	for _, group := range file.Comments {
+		if group == preamble {
+			continue
+		}
+		for _, c := range group.List {
+			// ディレクティブは rewriteDirectives で書き換える
+			if strings.HasPrefix(c.Text, "//go:") {
+				continue
+			}
+			text := c.Text
+			for from, to := range replacements {
+				text = strings.ReplaceAll(text, from, to)
+			}
+			if mention != nil {
+				text = mention.ReplaceAllStringFunc(text, func(m string) string {
+					sub := mention.FindStringSubmatch(m)
+					if !t.targetSymbols[sub[3]] {
+						return m
+					}
+					return sub[1] + qualify(newQualifier, t.transformSymbolName(sub[3]))
+				})
+			}
+			if text != c.Text {
+				debugf("Update comment %q -> %q", c.Text, text)
+				c.Text = text
+				modified = true
+			}
+		}
+	}
+	return modified
+}
+
+// rewriteDocNames は名前を変えた宣言のドキュメントが慣例どおり宣言の名前で始まっていれば、新しい名前にする
+func (t *Transformer) rewriteDocNames(file *ast.File) bool {
+	modified := false
+	rewrite := func(doc *ast.CommentGroup, name string) {
+		if doc == nil || len(doc.List) == 0 || !t.targetSymbols[name] {
+			return
+		}
+		newName := t.transformSymbolName(name)
+		first := doc.List[0]
+		if rest, ok := strings.CutPrefix(first.Text, "// "+name+" "); ok && newName != name {
+			first.Text = "// " + newName + " " + rest
+			modified = true
+		}
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				rewrite(decl.Doc, t.originalName(decl.Name.Name))
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					doc := spec.Doc
+					if doc == nil && len(decl.Specs) == 1 {
+						doc = decl.Doc
+					}
+					rewrite(doc, t.originalName(spec.Name.Name))
+				case *ast.ValueSpec:
+					doc := spec.Doc
+					if doc == nil && len(decl.Specs) == 1 {
+						doc = decl.Doc
+					}
+					for _, name := range spec.Names {
+						rewrite(doc, t.originalName(name.Name))
+					}
+				}
+			}
+		}
+	}
+	return modified
+}
+
+// originalName はターゲットファイルで名前を変えた識別子の元の名前を返す
+func (t *Transformer) originalName(name string) string {
+	for sym := range t.targetSymbols {
+		if t.transformSymbolName(sym) == name {
+			return sym
+		}
+	}
+	return name
+}
+
+// docLinks はドキュメント中のすべてのドキュメントリンクを返す
+func docLinks(blocks []comment.Block) []*comment.DocLink {
+	var links []*comment.DocLink
+	var walkText func(texts []comment.Text)
+	walkText = func(texts []comment.Text) {
+		for _, text := range texts {
+			switch text := text.(type) {
+			case *comment.DocLink:
+				links = append(links, text)
+			case *comment.Link:
+				walkText(text.Text)
+			}
+		}
+	}
+	for _, block := range blocks {
+		switch block := block.(type) {
+		case *comment.Paragraph:
+			walkText(block.Text)
+		case *comment.Heading:
+			walkText(block.Text)
+		case *comment.List:
+			for _, item := range block.Items {
+				links = append(links, docLinks(item.Content)...)
+			}
+		}
+	}
+	return links
+}
+
+// plainText はドキュメントリンクの表示テキストを返す
+func plainText(texts []comment.Text) string {
+	var b strings.Builder
+	for _, text := range texts {
+		switch text := text.(type) {
+		case comment.Plain:
+			b.WriteString(string(text))
+		case comment.Italic:
+			b.WriteString(string(text))
+		}
+	}
+	return b.String()
+}
+
+// usesQualifier はファイルのコードが name で修飾した参照を含むかを返す
+// Transformer は修飾した参照を "pkg.Name" という名前の識別子で表すため、両方の形を調べる
+func usesQualifier(file *ast.File, name string) bool {
+	found := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.Ident:
+			found = strings.HasPrefix(n.Name, name+".")
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok && x.Name == name {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
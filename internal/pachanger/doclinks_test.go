@@ -0,0 +1,38 @@
+package pachanger_test
+
+import (
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteDocLinks(t *testing.T) {
+	files := map[string]string{
+		"model/user.go": "package model\n\n// User is a user. It embeds [Base].\ntype User struct{ Base }\n\n// NewUser returns a [*User]. See [User.Name].\nfunc NewUser() *User { return &User{} }\n\nfunc (u User) Name() string { return \"\" }\n",
+		"model/base.go": "package model\n\n// Base is embedded in [User].\ntype Base struct{}\n",
+		"app/app.go":    "package app\n\nimport \"example.com/mod/model\"\n\n// U is a [model.User] built by model.NewUser.\nvar U = model.NewUser()\n",
+	}
+
+	transform := func(t *testing.T, rewriteMentions bool) func(string) string {
+		cfg := moveConfig{addPrefix: "X", setup: func(transformer *pachanger.Transformer) {
+			transformer.SetRewriteMentions(rewriteMentions)
+		}}
+		_, _, read := moveAndRead(t, files, cfg, "model/user.go", "model/user/user.go", "model/base.go", "app/app.go")
+		return read
+	}
+
+	t.Run("ドキュメントリンクを書き換える場合", func(t *testing.T) {
+		read := transform(t, false)
+		assert.Contains(t, read("model/user/user.go"), "// User is a user. It embeds [model.Base].\n")
+		assert.Contains(t, read("model/user/user.go"), "// NewUser returns a [*XUser]. See [XUser.Name].\n")
+		assert.Contains(t, read("model/base.go"), "// Base is embedded in [example.com/mod/model/user.XUser].\n")
+		assert.Contains(t, read("app/app.go"), "// U is a [user.XUser] built by model.NewUser.\n")
+	})
+
+	t.Run("コメント中の記述も書き換える場合", func(t *testing.T) {
+		read := transform(t, true)
+		assert.Contains(t, read("model/user/user.go"), "// XUser is a user. It embeds [model.Base].\n")
+		assert.Contains(t, read("app/app.go"), "// U is a [user.XUser] built by user.XNewUser.\n")
+	})
+}
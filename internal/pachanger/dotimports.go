@@ -0,0 +1,136 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// DotImportMode はドットimportで参照している移動したシンボルの書き換え方
+type DotImportMode string
+
+const (
+	// DotImportKeep は移動先のパッケージもドットimportし、修飾しないまま参照する
+	DotImportKeep DotImportMode = "keep"
+	// DotImportQualify は移動先のパッケージを通常のimportにし、パッケージ名で修飾する
+	DotImportQualify DotImportMode = "qualify"
+)
+
+// ParseDotImportMode は --dot-import フラグの値を解析する
+func ParseDotImportMode(s string) (DotImportMode, error) {
+	switch mode := DotImportMode(s); mode {
+	case DotImportKeep, DotImportQualify:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown dot import mode %q: must be one of keep, qualify", s)
+}
+
+// SetDotImportMode はドットimportで参照している移動したシンボルの書き換え方を変更する
+func (t *Transformer) SetDotImportMode(mode DotImportMode) {
+	t.dotImportMode = mode
+}
+
+// rewriteImportedUses は移動元のパッケージをドットimportまたはブランクimportしている
+// ファイルの参照とimportを書き換える。書き換えた場合は true を返す
+func (t *Transformer) rewriteImportedUses(file *ast.File, pkgPath string, typesInfo *types.Info) bool {
+	dotImported, blankImported := false, false
+	for _, spec := range file.Imports {
+		if spec.Name == nil || strings.Trim(spec.Path.Value, `"`) != t.oldPkgPath {
+			continue
+		}
+		dotImported = dotImported || spec.Name.Name == "."
+		blankImported = blankImported || spec.Name.Name == "_"
+	}
+
+	// import を書き換えるため、file.Imports を走査し終えてから処理する
+	modified := false
+	if dotImported && t.rewriteDotImportedUses(file, pkgPath, typesInfo) {
+		modified = true
+	}
+	// 移動したファイルの init が実行されなくならないよう、移動先もブランクimportする
+	if blankImported && t.movesInit && pkgPath != t.newPkgPath && astutil.AddNamedImport(t.fs, file, "_", t.newPkgPath) {
+		debugf("Add blank import of %s", t.newPkgPath)
+		modified = true
+	}
+	return modified
+}
+
+// rewriteDotImportedUses はドットimportした移動元のパッケージから参照している、移動したシンボルを書き換える
+// 修飾子のない識別子は名前だけでは判別できないため、型情報から参照先を調べる
+func (t *Transformer) rewriteDotImportedUses(file *ast.File, pkgPath string, typesInfo *types.Info) bool {
+	// パッケージ名で修飾した参照はドットimportによるものではない
+	qualified := map[*ast.Ident]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				if _, ok := typesInfo.Uses[x].(*types.PkgName); ok {
+					qualified[sel.Sel] = true
+				}
+			}
+		}
+		return true
+	})
+
+	moved := []*ast.Ident{}
+	remaining := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || qualified[ident] {
+			return true
+		}
+		obj := typesInfo.Uses[ident]
+		if obj == nil || obj.Pkg() == nil || obj.Pkg().Path() != t.oldPkgPath || obj.Parent() != obj.Pkg().Scope() {
+			return true
+		}
+		if t.targetSymbols[obj.Name()] {
+			moved = append(moved, ident)
+		} else if !t.isMovedDecl(obj) {
+			remaining++
+		}
+		return true
+	})
+	if len(moved) == 0 {
+		return false
+	}
+
+	inNewPkg := pkgPath == t.newPkgPath
+	for _, ident := range moved {
+		before := ident.Name
+		ident.Name = t.transformSymbolName(ident.Name)
+		if !inNewPkg && t.dotImportMode == DotImportQualify {
+			ident.Name = fmt.Sprintf("%s.%s", t.newPkg, ident.Name)
+		}
+		t.addDoneList(ident)
+		debugf("Update dot imported Ident %s -> %s", before, ident.Name)
+	}
+
+	// goimports はドットimportを削除しないため、使われなくなった移動元のimportはここで削除する
+	if remaining == 0 {
+		debugf("Delete dot import of %s", t.oldPkgPath)
+		astutil.DeleteNamedImport(t.fs, file, ".", t.oldPkgPath)
+	}
+	if !inNewPkg && t.dotImportMode != DotImportQualify {
+		astutil.AddNamedImport(t.fs, file, ".", t.newPkgPath)
+	}
+	return true
+}
+
+// isMovedDecl は obj が移動したファイルで宣言されているかを返す
+func (t *Transformer) isMovedDecl(obj types.Object) bool {
+	filename := t.fs.Position(obj.Pos()).Filename
+	d := t.getDoneFile(filename)
+	return d != nil && d.output != filename
+}
+
+// declaresInit はファイルが init 関数を宣言しているかを返す
+func declaresInit(file *ast.File) bool {
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "init" {
+			return true
+		}
+	}
+	return false
+}
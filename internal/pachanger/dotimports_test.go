@@ -0,0 +1,37 @@
+package pachanger_test
+
+import (
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteDotImports(t *testing.T) {
+	files := map[string]string{
+		"model/user.go": "package model\n\ntype User struct{ Name string }\n\nfunc NewUser() *User { return &User{} }\n\nfunc init() {}\n",
+		"model/base.go": "package model\n\ntype Base struct{}\n",
+		"app/app.go":    "package app\n\nimport . \"example.com/mod/model\"\n\nvar U = NewUser()\n\nvar B Base\n",
+		"app/only.go":   "package app\n\nimport . \"example.com/mod/model\"\n\nvar O *User\n",
+		"app/blank.go":  "package app\n\nimport _ \"example.com/mod/model\"\n",
+	}
+
+	transform := func(t *testing.T, mode pachanger.DotImportMode) func(string) string {
+		cfg := moveConfig{setup: func(transformer *pachanger.Transformer) { transformer.SetDotImportMode(mode) }}
+		_, _, read := moveAndRead(t, files, cfg, "model/user.go", "model/user/user.go", "model/base.go", "app/app.go", "app/only.go", "app/blank.go")
+		return read
+	}
+
+	t.Run("ドットimportを維持する場合", func(t *testing.T) {
+		read := transform(t, pachanger.DotImportKeep)
+		assert.Equal(t, "package app\n\nimport (\n\t. \"example.com/mod/model\"\n\t. \"example.com/mod/model/user\"\n)\n\nvar U = NewUser()\n\nvar B Base\n", read("app/app.go"))
+		assert.Equal(t, "package app\n\nimport . \"example.com/mod/model/user\"\n\nvar O *User\n", read("app/only.go"))
+		assert.Equal(t, "package app\n\nimport (\n\t_ \"example.com/mod/model\"\n\t_ \"example.com/mod/model/user\"\n)\n", read("app/blank.go"))
+	})
+
+	t.Run("パッケージ名で修飾する場合", func(t *testing.T) {
+		read := transform(t, pachanger.DotImportQualify)
+		assert.Equal(t, "package app\n\nimport (\n\t. \"example.com/mod/model\"\n\t\"example.com/mod/model/user\"\n)\n\nvar U = user.NewUser()\n\nvar B Base\n", read("app/app.go"))
+		assert.Equal(t, "package app\n\nimport \"example.com/mod/model/user\"\n\nvar O *user.User\n", read("app/only.go"))
+	})
+}
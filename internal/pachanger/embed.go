@@ -0,0 +1,210 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/ast"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EmbeddedAsset は移動するファイルが go:embed で埋め込んでいる、一緒に移動するファイル
+type EmbeddedAsset struct {
+	From string
+	To   string
+}
+
+// PlanEmbeddedAssets は targets の go:embed が埋め込むファイルと、出力先のディレクトリでの移動先を返す
+// targets のキーは移動するファイル、値は出力先のパス
+// 移動しないファイルも同じファイルを埋め込んでいる場合はエラーにする
+func (t *Transformer) PlanEmbeddedAssets(targets map[string]string) ([]EmbeddedAsset, error) {
+	var assets []EmbeddedAsset
+	planned := map[string]string{}
+	for target, output := range targets {
+		file, _, err := t.findPackageForFile(target)
+		if err != nil {
+			return nil, err
+		}
+		srcDir, outDir := filepath.Dir(target), filepath.Dir(output)
+		if srcDir == outDir {
+			continue
+		}
+		embedded, err := embeddedFiles(srcDir, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve go:embed in %s: %w", target, err)
+		}
+		if len(embedded) == 0 {
+			continue
+		}
+
+		// 移動元のディレクトリに残るファイルが埋め込んでいるものは移動できない
+		for other, otherFile := range t.filesInDir(srcDir) {
+			if _, ok := targets[other]; ok {
+				continue
+			}
+			shared, err := embeddedFiles(srcDir, otherFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve go:embed in %s: %w", other, err)
+			}
+			for _, rel := range shared {
+				if slices.Contains(embedded, rel) {
+					return nil, fmt.Errorf("embedded file %s is shared by %s and %s, which stays in %s", rel, target, other, srcDir)
+				}
+			}
+		}
+
+		for _, rel := range embedded {
+			from := filepath.Join(srcDir, rel)
+			to := filepath.Join(outDir, rel)
+			if prev, ok := planned[from]; ok {
+				if prev != to {
+					return nil, fmt.Errorf("embedded file %s would be moved to both %s and %s", from, prev, to)
+				}
+				continue
+			}
+			planned[from] = to
+			assets = append(assets, EmbeddedAsset{From: from, To: to})
+		}
+	}
+	slices.SortFunc(assets, func(a, b EmbeddedAsset) int { return strings.Compare(a.From, b.From) })
+	return assets, nil
+}
+
+// MoveEmbeddedAssets は埋め込まれているファイルを相対的な配置を保ったまま移動する
+func MoveEmbeddedAssets(journal *Journal, assets []EmbeddedAsset) error {
+	for _, asset := range assets {
+		src, err := os.ReadFile(asset.From)
+		if err != nil {
+			return fmt.Errorf("failed to read embedded file %s: %w", asset.From, err)
+		}
+		if err := journal.MkdirAll(filepath.Dir(asset.To)); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", asset.To, err)
+		}
+		if err := journal.RecordMove(asset.From, asset.To); err != nil {
+			return fmt.Errorf("failed to record moved file: %w", err)
+		}
+		if err := os.WriteFile(asset.To, src, 0o644); err != nil {
+			return fmt.Errorf("failed to write embedded file %s: %w", asset.To, err)
+		}
+		if err := journal.Remove(asset.From); err != nil {
+			return fmt.Errorf("failed to remove embedded file %s: %w", asset.From, err)
+		}
+	}
+	return nil
+}
+
+// filesInDir は dir にあるパッケージのファイルを返す
+// テスト用のパッケージにも同じファイルが含まれるため、ファイル名で重複を除く
+func (t *Transformer) filesInDir(dir string) map[string]*ast.File {
+	files := map[string]*ast.File{}
+	for _, pkg := range t.allPkgs {
+		for _, file := range pkg.Syntax {
+			filename := t.fs.Position(file.Pos()).Filename
+			if filepath.Dir(filename) == dir {
+				files[filename] = file
+			}
+		}
+	}
+	return files
+}
+
+// embeddedFiles は file の go:embed ディレクティブが埋め込むファイルを dir からの相対パスで返す
+func embeddedFiles(dir string, file *ast.File) ([]string, error) {
+	var files []string
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			args, ok := strings.CutPrefix(c.Text, "//go:embed ")
+			if !ok {
+				continue
+			}
+			patterns, err := parseEmbedPatterns(args)
+			if err != nil {
+				return nil, err
+			}
+			for _, pattern := range patterns {
+				matched, err := resolveEmbedPattern(dir, pattern)
+				if err != nil {
+					return nil, err
+				}
+				for _, rel := range matched {
+					if !slices.Contains(files, rel) {
+						files = append(files, rel)
+					}
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// parseEmbedPatterns は go:embed の引数をパターンに分割する。パターンは引用符で囲まれている場合がある
+func parseEmbedPatterns(args string) ([]string, error) {
+	var patterns []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		switch args[0] {
+		case '"', '`':
+			quoted, err := strconv.QuotedPrefix(args)
+			if err != nil {
+				return nil, fmt.Errorf("invalid go:embed pattern %s: %w", args, err)
+			}
+			pattern, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("invalid go:embed pattern %s: %w", quoted, err)
+			}
+			patterns = append(patterns, pattern)
+			args = args[len(quoted):]
+		default:
+			end := strings.IndexAny(args, " \t")
+			if end < 0 {
+				end = len(args)
+			}
+			patterns = append(patterns, args[:end])
+			args = args[end:]
+		}
+	}
+	return patterns, nil
+}
+
+// resolveEmbedPattern はパターンに一致するファイルを dir からの相対パスで返す
+// ディレクトリに一致した場合は、go build と同様に . と _ で始まるファイルを all: の指定がない限り除く
+func resolveEmbedPattern(dir, pattern string) ([]string, error) {
+	pattern, all := strings.CutPrefix(pattern, "all:")
+	matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid go:embed pattern %s: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("go:embed pattern %s matches no files", pattern)
+	}
+
+	var files []string
+	for _, match := range matches {
+		err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != match && !all && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,60 @@
+package pachanger_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanEmbeddedAssets(t *testing.T) {
+	t.Run("埋め込んだファイルを移動する場合", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"web/page.go":                "package web\n\nimport \"embed\"\n\n//go:embed templates/* \"static/app.css\"\nvar Assets embed.FS\n",
+			"web/server.go":              "package web\n\nfunc Serve() {}\n",
+			"web/templates/index.html":   "<html></html>\n",
+			"web/templates/.hidden.html": "hidden\n",
+			"web/static/app.css":         "body {}\n",
+		})
+		target := filepath.Join(workDir, "web/page.go")
+		output := filepath.Join(workDir, "web/page/page.go")
+
+		transformer, err := pachanger.NewTransformer(workDir, "page", "", "", nil)
+		assert.NoError(t, err)
+		assets, err := transformer.PlanEmbeddedAssets(map[string]string{target: output})
+		assert.NoError(t, err)
+		assert.Equal(t, []pachanger.EmbeddedAsset{
+			{From: filepath.Join(workDir, "web/static/app.css"), To: filepath.Join(workDir, "web/page/static/app.css")},
+			{From: filepath.Join(workDir, "web/templates/.hidden.html"), To: filepath.Join(workDir, "web/page/templates/.hidden.html")},
+			{From: filepath.Join(workDir, "web/templates/index.html"), To: filepath.Join(workDir, "web/page/templates/index.html")},
+		}, assets)
+
+		journal, err := pachanger.NewJournal(workDir, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, pachanger.MoveEmbeddedAssets(journal, assets))
+		got, err := os.ReadFile(filepath.Join(workDir, "web/page/templates/index.html"))
+		assert.NoError(t, err)
+		assert.Equal(t, "<html></html>\n", string(got))
+		assert.NoFileExists(t, filepath.Join(workDir, "web/templates/index.html"))
+
+		assert.NoError(t, journal.Save())
+		assert.NoError(t, journal.Undo(false))
+		assert.FileExists(t, filepath.Join(workDir, "web/templates/index.html"))
+		assert.NoFileExists(t, filepath.Join(workDir, "web/page/templates/index.html"))
+	})
+
+	t.Run("移動しないファイルと共有している場合", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"web/page.go":              "package web\n\nimport _ \"embed\"\n\n//go:embed templates/index.html\nvar Index string\n",
+			"web/server.go":            "package web\n\nimport \"embed\"\n\n//go:embed templates\nvar Templates embed.FS\n",
+			"web/templates/index.html": "<html></html>\n",
+		})
+		target := filepath.Join(workDir, "web/page.go")
+		transformer, err := pachanger.NewTransformer(workDir, "page", "", "", nil)
+		assert.NoError(t, err)
+		_, err = transformer.PlanEmbeddedAssets(map[string]string{target: filepath.Join(workDir, "web/page/page.go")})
+		assert.ErrorContains(t, err, "embedded file templates/index.html is shared by")
+	})
+}
@@ -0,0 +1,115 @@
+package pachanger
+
+import (
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// symbolName はレポートに表示するシンボルの名前を返す
+// メソッドとフィールドは同じ名前が複数の型にありうるため、型名を付ける
+func (g *ExposeRenamer) symbolName(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Func:
+		if recv := obj.Type().(*types.Signature).Recv(); recv != nil {
+			if named := namedOf(recv.Type()); named != nil {
+				return named.Obj().Name() + "." + obj.Name()
+			}
+		}
+	case *types.Var:
+		if !obj.IsField() {
+			break
+		}
+		for _, named := range g.namedTypes() {
+			st, ok := named.Underlying().(*types.Struct)
+			if !ok {
+				continue
+			}
+			for i := 0; i < st.NumFields(); i++ {
+				if st.Field(i) == obj {
+					return named.Obj().Name() + "." + obj.Name()
+				}
+			}
+		}
+	}
+	return obj.Name()
+}
+
+// namedTypes はパッケージレベルで宣言された型を返す
+func (g *ExposeRenamer) namedTypes() []*types.Named {
+	var named []*types.Named
+	scope := g.pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		if n, ok := tn.Type().(*types.Named); ok {
+			named = append(named, n)
+		}
+	}
+	return named
+}
+
+// relatedMethods は fn と同じ名前でなければならないメソッドを返す
+// インターフェースのメソッドならパッケージ内の実装のメソッドを、
+// 具象型のメソッドなら実装しているインターフェースのメソッドを返す
+// 非公開のメソッドは同じパッケージの中でしか満たせないため、パッケージ内だけを調べればよい
+func (g *ExposeRenamer) relatedMethods(fn *types.Func) []types.Object {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return nil
+	}
+	recvNamed := namedOf(recv.Type())
+
+	var related []types.Object
+	for _, named := range g.namedTypes() {
+		if named.TypeParams().Len() > 0 || named == recvNamed {
+			continue
+		}
+		if types.IsInterface(recv.Type()) {
+			// インターフェースのメソッド -> 実装しているパッケージ内の型のメソッド
+			if types.IsInterface(named) || !types.Implements(types.NewPointer(named), recv.Type().Underlying().(*types.Interface)) {
+				continue
+			}
+			obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), false, g.pkg, fn.Name())
+			if m, ok := obj.(*types.Func); ok && m.Pkg() == g.pkg {
+				related = append(related, m)
+			}
+			continue
+		}
+		// 具象型のメソッド -> 実装しているインターフェースのメソッド
+		iface, ok := named.Underlying().(*types.Interface)
+		if !ok || recvNamed == nil || recvNamed.TypeParams().Len() > 0 {
+			continue
+		}
+		for i := 0; i < iface.NumMethods(); i++ {
+			m := iface.Method(i)
+			if m.Name() == fn.Name() && types.Implements(types.NewPointer(recvNamed), iface) {
+				related = append(related, m)
+			}
+		}
+	}
+	return related
+}
+
+// renamed は pos の識別子がすでに newName になっているかを返す
+func renamed(pos token.Position, newName string) bool {
+	src, err := os.ReadFile(pos.Filename)
+	if err != nil {
+		return false
+	}
+	lines := strings.Split(string(src), "\n")
+	if pos.Line < 1 || pos.Line > len(lines) || pos.Column < 1 || pos.Column > len(lines[pos.Line-1]) {
+		return false
+	}
+	rest, ok := strings.CutPrefix(lines[pos.Line-1][pos.Column-1:], newName)
+	if !ok {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return rest == "" || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
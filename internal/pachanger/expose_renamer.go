@@ -1,6 +1,7 @@
 package pachanger
 
 import (
+	"cmp"
 	"fmt"
 	"go/ast"
 	"go/token"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -23,6 +25,8 @@ type ExposeRenamer struct {
 	buildFlags       []string
 	execute          bool
 	processedObjects map[types.Object]bool
+	// ターゲットファイルを含むパッケージ。メソッド集合の判定に使う
+	pkg *types.Package
 }
 
 func NewExposeRenamer(workDir, targetFile, tagsFlag string, execute bool) (*ExposeRenamer, error) {
@@ -50,11 +54,53 @@ func NewExposeRenamer(workDir, targetFile, tagsFlag string, execute bool) (*Expo
 	}, nil
 }
 
+// Generate は公開が必要なシンボルを調べ、gopls rename コマンドを出力する
+// execute が指定されていればコマンドを実行する
 func (g *ExposeRenamer) Generate() error {
-	pkgs, err := loadPackages(g.fs, g.workDir, g.buildFlags)
+	report, err := g.Report()
 	if err != nil {
 		return err
 	}
+	g.Run(report)
+	return nil
+}
+
+// Run は report の gopls rename コマンドを出力し、execute が指定されていれば実行する
+func (g *ExposeRenamer) Run(report *ExposeReport) {
+	for _, symbol := range report.Symbols {
+		slog.Info("gopls rename command", "command", symbol.Command)
+		if !g.execute {
+			continue
+		}
+		// 実行する場合は、gopls コマンドを実行
+		// インターフェースと実装のメソッドは gopls が一緒に名前を変えることがある
+		if renamed(symbol.target, symbol.NewName) {
+			slog.Debug("already renamed", "symbol", symbol.Name)
+			continue
+		}
+		target := fmt.Sprintf("%s:%d:%d", symbol.target.Filename, symbol.target.Line, symbol.target.Column)
+		cmd := exec.Command("gopls", "rename", "-w", target, symbol.NewName)
+		env := os.Environ()
+		if g.buildFlags != nil {
+			env = append(env, fmt.Sprintf("GOFLAGS=%s", strings.Join(g.buildFlags, "=")))
+		}
+		cmd.Env = env
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			slog.Error("gopls rename command failed", "error", err, "output", string(out))
+		}
+	}
+}
+
+// Report はターゲットファイルの外から使われている非公開のシンボルと、
+// 使われている位置、宣言をたどって公開が必要になった経路をまとめる
+func (g *ExposeRenamer) Report() (*ExposeReport, error) {
+	g.processedObjects = map[types.Object]bool{}
+	pkgs, err := loadPackages(g.fs, g.workDir, g.buildFlags)
+	if err != nil {
+		return nil, err
+	}
 	// エラーがあっても解析を続ける場合
 	if packages.PrintErrors(pkgs) > 0 {
 		slog.Warn("Some packages contain errors")
@@ -92,13 +138,14 @@ func (g *ExposeRenamer) Generate() error {
 		}
 	}
 	if targetPkg == nil || targetFile == nil {
-		return fmt.Errorf("target file not found: %s", g.targetFile)
+		return nil, fmt.Errorf("target file not found: %s", g.targetFile)
 	}
 
 	info := targetPkg.TypesInfo
+	g.pkg = targetPkg.Types
 
 	// パッケージ全体の使用状況から、「ターゲットファイル以外」で使われているオブジェクトを記録
-	usedOutside := make(map[types.Object]bool)
+	usedOutside := make(map[types.Object][]token.Position)
 	for ident, obj := range info.Uses {
 		pos := targetPkg.Fset.Position(ident.Pos())
 		absPos, err := filepath.Abs(pos.Filename)
@@ -106,12 +153,13 @@ func (g *ExposeRenamer) Generate() error {
 			continue
 		}
 		if absPos != g.targetFile {
-			usedOutside[obj] = true
+			usedOutside[obj] = append(usedOutside[obj], pos)
 		}
 	}
 
 	// パッケージ内の全 AST から宣言ノードをマップとして作成
 	declMap := buildDeclMap(targetPkg.Syntax)
+	report := &ExposeReport{File: g.relPath(g.targetFile)}
 
 	// ターゲットファイルの AST を走査し、対象となる識別子を探索
 	ast.Inspect(targetFile, func(n ast.Node) bool {
@@ -137,13 +185,13 @@ func (g *ExposeRenamer) Generate() error {
 			return true
 		}
 		// ターゲットファイル外で使われていない
-		if !usedOutside[obj] {
+		if len(usedOutside[obj]) == 0 {
 			return true
 		}
-		g.processObject(obj, info, declMap, usedOutside)
+		g.processObject(report, obj, nil, info, declMap, usedOutside)
 		return true
 	})
-	return nil
+	return report, nil
 }
 
 // buildDeclMap は、与えられた AST ファイル群から宣言ノードのマップを作成します。
@@ -167,6 +215,14 @@ func buildDeclMap(files []*ast.File) map[token.Pos]ast.Node {
 					case *ast.TypeSpec:
 						// 型そのもの
 						declMap[s.Name.NamePos] = s
+						// interface 型の場合、メソッドを走査する
+						if ifaceType, ok := s.Type.(*ast.InterfaceType); ok {
+							for _, method := range ifaceType.Methods.List {
+								for _, name := range method.Names {
+									declMap[name.NamePos] = method
+								}
+							}
+						}
 						// struct 型の場合、フィールドを走査する
 						if structType, ok := s.Type.(*ast.StructType); ok {
 							for _, field := range structType.Fields.List {
@@ -218,7 +274,7 @@ func capitalizeFirst(s string) string {
 	return strings.ToUpper(s[:1]) + s[1:]
 }
 
-func (g *ExposeRenamer) processObject(obj types.Object, info *types.Info, declMap map[token.Pos]ast.Node, usedOutside map[types.Object]bool) {
+func (g *ExposeRenamer) processObject(report *ExposeReport, obj types.Object, chain []string, info *types.Info, declMap map[token.Pos]ast.Node, usedOutside map[types.Object][]token.Position) {
 	if g.processedObjects[obj] {
 		return
 	}
@@ -229,23 +285,31 @@ func (g *ExposeRenamer) processObject(obj types.Object, info *types.Info, declMa
 	if exportedName == obj.Name() {
 		return
 	}
-	goplsCmd := fmt.Sprintf("gopls rename -w %s:%d:%d %s", pos.Filename, pos.Line, pos.Column, exportedName)
-	slog.Info("gopls rename command", "command", goplsCmd)
-	if g.execute {
-		// 実行する場合は、gopls コマンドを実行
-		cmd := exec.Command("gopls", "rename", "-w", fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column), exportedName)
-		env := os.Environ()
-		if g.buildFlags != nil {
-			env = append(env, fmt.Sprintf("GOFLAGS=%s", strings.Join(g.buildFlags, "=")))
-		}
-		cmd.Env = env
+	name := g.symbolName(obj)
+	chain = append(slices.Clone(chain), name)
+	symbol := ExposedSymbol{
+		Name:     name,
+		NewName:  exportedName,
+		Kind:     objectKind(obj),
+		Position: fmt.Sprintf("%s:%d:%d", g.relPath(pos.Filename), pos.Line, pos.Column),
+		Chain:    chain,
+		Command:  fmt.Sprintf("gopls rename -w %s:%d:%d %s", pos.Filename, pos.Line, pos.Column, exportedName),
+		target:   pos,
+	}
+	uses := slices.Clone(usedOutside[obj])
+	slices.SortFunc(uses, func(a, b token.Position) int {
+		return cmp.Or(strings.Compare(a.Filename, b.Filename), cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	for _, use := range uses {
+		symbol.Uses = append(symbol.Uses, fmt.Sprintf("%s:%d:%d", g.relPath(use.Filename), use.Line, use.Column))
+	}
+	report.Symbols = append(report.Symbols, symbol)
 
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			slog.Error("gopls rename command failed", "error", err, "output", string(out))
-			return
+	// インターフェースのメソッドと実装は同じ名前でなければ満たす関係が壊れるため、一緒に公開する
+	if fn, ok := obj.(*types.Func); ok {
+		for _, related := range g.relatedMethods(fn) {
+			g.processObject(report, related, chain, info, declMap, usedOutside)
 		}
-
 	}
 
 	if decl, ok := declMap[obj.Pos()]; ok {
@@ -265,8 +329,8 @@ func (g *ExposeRenamer) processObject(obj types.Object, info *types.Info, declMa
 			}
 			// if innerObj.Pkg() != nil && innerObj.Pkg().Name() == obj.Pkg().Name() && isUnexported(innerObj.Name()) {
 			if innerObj.Pkg() != nil && innerObj.Pkg().Name() == obj.Pkg().Name() {
-				if usedOutside[innerObj] {
-					g.processObject(innerObj, info, declMap, usedOutside)
+				if len(usedOutside[innerObj]) > 0 {
+					g.processObject(report, innerObj, chain, info, declMap, usedOutside)
 				}
 			}
 			return true
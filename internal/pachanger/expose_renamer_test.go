@@ -0,0 +1,62 @@
+package pachanger_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExposeReport(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"foo/a.go": "package foo\n\ntype config struct{}\n\nfunc newConfig() *config { return &config{} }\n\nfunc helper() int { return 1 }\n",
+		"foo/b.go": "package foo\n\nvar _ config\n\nfunc Use() {\n\t_ = newConfig()\n\t_ = helper()\n}\n",
+	})
+
+	renamer, err := pachanger.NewExposeRenamer(workDir, filepath.Join(workDir, "foo/a.go"), "", false)
+	assert.NoError(t, err)
+	report, err := renamer.Report()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "foo/a.go", report.File)
+	assert.Len(t, report.Symbols, 3)
+	assert.Equal(t, "config", report.Symbols[0].Name)
+	assert.Equal(t, "type", report.Symbols[0].Kind)
+	assert.Equal(t, []string{"foo/b.go:3:7"}, report.Symbols[0].Uses)
+	assert.Equal(t, "newConfig", report.Symbols[1].Name)
+	assert.Equal(t, "NewConfig", report.Symbols[1].NewName)
+	assert.Equal(t, "foo/a.go:5:6", report.Symbols[1].Position)
+	assert.Equal(t, []string{"helper"}, report.Symbols[2].Chain)
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteDOT(&buf))
+	assert.Contains(t, buf.String(), "\"foo/b.go\" -> \"helper\" [label=\"7:6\"];\n")
+}
+
+func TestExposeReportMethods(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"foo/a.go": "package foo\n\ntype runner interface {\n\trun()\n}\n\ntype job struct{}\n\nfunc (j *job) run() {}\n",
+		"foo/b.go": "package foo\n\ntype other struct{}\n\nfunc (o other) run() {}\n\nfunc Use(r runner) {\n\tr.run()\n}\n",
+	})
+
+	renamer, err := pachanger.NewExposeRenamer(workDir, filepath.Join(workDir, "foo/a.go"), "", false)
+	assert.NoError(t, err)
+	report, err := renamer.Report()
+	assert.NoError(t, err)
+
+	var names []string
+	for _, s := range report.Symbols {
+		names = append(names, s.Name)
+	}
+	// インターフェースのメソッドを公開すると、別ファイルのものも含めて実装のメソッドも公開する
+	assert.ElementsMatch(t, []string{"runner", "runner.run", "job.run", "other.run"}, names)
+	for _, s := range report.Symbols {
+		if s.Name == "other.run" {
+			assert.Equal(t, "foo/b.go:5:16", s.Position)
+			assert.Equal(t, []string{"runner.run", "other.run"}, s.Chain)
+			assert.Equal(t, "method", s.Kind)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package pachanger
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ExposeReport は expose で公開が必要になるシンボルの一覧
+type ExposeReport struct {
+	File    string          `json:"file"`
+	Symbols []ExposedSymbol `json:"symbols"`
+}
+
+// ExposedSymbol は公開が必要なシンボルと、その理由
+type ExposedSymbol struct {
+	Name     string `json:"name"`
+	NewName  string `json:"new_name"`
+	Kind     string `json:"kind"`
+	Position string `json:"position"`
+	// ターゲットファイルの外でこのシンボルを使っている位置
+	Uses []string `json:"uses"`
+	// ターゲットファイルの外から使われている宣言から、このシンボルにたどり着くまでの宣言の経路
+	Chain   []string `json:"chain"`
+	Command string   `json:"command"`
+
+	// gopls rename に渡す位置
+	target token.Position
+}
+
+// objectKind はシンボルの種類を返す
+func objectKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Const:
+		return "const"
+	case *types.TypeName:
+		return "type"
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+		return "var"
+	case *types.Func:
+		if obj.Type().(*types.Signature).Recv() != nil {
+			return "method"
+		}
+		return "func"
+	}
+	return "other"
+}
+
+// relPath は作業ディレクトリからの相対パスを返す
+func (g *ExposeRenamer) relPath(path string) string {
+	rel, err := filepath.Rel(g.workDir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// WriteText は公開が必要なシンボルを人が読める形式で書き出す
+func (r *ExposeReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Symbols to expose in %s\n", r.File)
+	for _, s := range r.Symbols {
+		fmt.Fprintf(&b, "\n%s %s -> %s (%s)\n", s.Kind, s.Name, s.NewName, s.Position)
+		if len(s.Chain) > 1 {
+			fmt.Fprintf(&b, "  via:  %s\n", strings.Join(s.Chain, " -> "))
+		}
+		for _, use := range s.Uses {
+			fmt.Fprintf(&b, "  used: %s\n", use)
+		}
+		fmt.Fprintf(&b, "  %s\n", s.Command)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON は公開が必要なシンボルをJSONで書き出す
+func (r *ExposeReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteDOT は宣言の経路と使っているファイルを Graphviz の DOT 形式で書き出す
+func (r *ExposeReport) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph expose {\n")
+	b.WriteString("\trankdir=LR;\n")
+	edges := map[string]bool{}
+	edge := func(from, to, label string) {
+		line := fmt.Sprintf("\t%q -> %q", from, to)
+		if label != "" {
+			line += fmt.Sprintf(" [label=%q]", label)
+		}
+		line += ";\n"
+		if !edges[line] {
+			edges[line] = true
+			b.WriteString(line)
+		}
+	}
+	for _, s := range r.Symbols {
+		fmt.Fprintf(&b, "\t%q [shape=box, label=%q];\n", s.Name, s.Kind+" "+s.Name)
+		if len(s.Chain) > 1 {
+			edge(s.Chain[len(s.Chain)-2], s.Name, "")
+		}
+		for _, use := range s.Uses {
+			file, pos, _ := strings.Cut(use, ":")
+			edge(file, s.Name, pos)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
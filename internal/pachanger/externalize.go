@@ -0,0 +1,485 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// ExternalizeSummary は内部テストを外部テストパッケージへ移した結果
+type ExternalizeSummary struct {
+	// パッケージ名で修飾した参照の数
+	References int
+	// export_test.go に追加した公開用の宣言
+	Shims []string
+	// テスト用コンストラクタに置き換えた構造体リテラルの数
+	Literals int
+}
+
+// externalizer は1つのテストファイルを外部テストパッケージへ移すための状態
+type externalizer struct {
+	fs       *token.FileSet
+	testFile string
+	suffix   string
+	pkg      *packages.Package
+	file     *ast.File
+
+	// 生成する宣言。名前から生成コードへの対応
+	shims   map[string]string
+	imports map[string]string
+	// 変数の参照を置き換えるために作った間接参照。&x の書き換えで取り除く
+	derefs map[*ast.StarExpr]bool
+	// 非公開フィールドを持つ構造体のリテラルがあるか
+	hasLiterals bool
+	references  int
+	errs        []string
+}
+
+// ExternalizeTest は testFile をパッケージ foo の内部テストから外部テストパッケージ foo_test へ移す
+// パッケージレベルの参照を foo. で修飾し、参照している非公開のシンボルは export_test.go に
+// suffix を付けた公開名の宣言を生成して置き換える。非公開フィールドを持つ構造体のリテラルは
+// migrate struct と同じテスト用コンストラクタの呼び出しに置き換える
+func ExternalizeTest(journal *Journal, workDir, testFile, suffix string, buildFlags []string) (*ExternalizeSummary, error) {
+	if !strings.HasSuffix(testFile, "_test.go") {
+		return nil, fmt.Errorf("%s is not a test file", testFile)
+	}
+	fs := token.NewFileSet()
+	pkgs, err := loadPackages(fs, workDir, buildFlags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+
+	e := &externalizer{
+		fs:       fs,
+		testFile: testFile,
+		suffix:   suffix,
+		shims:    map[string]string{},
+		imports:  map[string]string{},
+		derefs:   map[*ast.StarExpr]bool{},
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			if fs.Position(file.Pos()).Filename == testFile {
+				e.pkg, e.file = pkg, file
+			}
+		}
+	}
+	if e.pkg == nil {
+		return nil, fmt.Errorf("file %s not found in packages", testFile)
+	}
+	if strings.HasSuffix(e.pkg.Name, "_test") {
+		return nil, fmt.Errorf("%s already belongs to the external test package %s", testFile, e.pkg.Name)
+	}
+
+	e.checkDecls(pkgs)
+	e.rewrite()
+	if len(e.errs) > 0 {
+		slices.Sort(e.errs)
+		return nil, fmt.Errorf("cannot externalize %s:\n%s", testFile, strings.Join(slices.Compact(e.errs), "\n"))
+	}
+
+	summary := &ExternalizeSummary{References: e.references, Shims: slices.Sorted(maps.Keys(e.shims))}
+
+	restore, err := chdirGoModDir(workDir)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	if len(e.shims) > 0 {
+		if err := e.writeShims(journal); err != nil {
+			return nil, err
+		}
+	}
+
+	e.file.Name.Name = e.pkg.Name + "_test"
+	if path.Base(e.pkg.PkgPath) == e.pkg.Name {
+		astutil.AddImport(fs, e.file, e.pkg.PkgPath)
+	} else {
+		astutil.AddNamedImport(fs, e.file, e.pkg.Name, e.pkg.PkgPath)
+	}
+	if err := journal.RecordFile(testFile); err != nil {
+		return nil, err
+	}
+	if err := writeFile(fs, e.file, testFile); err != nil {
+		return nil, err
+	}
+
+	if e.hasLiterals {
+		pattern, err := filepath.Rel(workDir, filepath.Dir(testFile))
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(pattern, ".") {
+			pattern = "./" + filepath.ToSlash(pattern)
+		}
+		ms, err := NewMigrateStruct(workDir, pattern, suffix)
+		if err != nil {
+			return nil, err
+		}
+		ms.SetExportTest(true)
+		ms.SetJournal(journal)
+		migrated, err := ms.MigrateFiles([]string{testFile})
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate struct literals: %w", err)
+		}
+		summary.Literals = migrated.Literals
+		summary.Shims = append(summary.Shims, migrated.Constructors...)
+	}
+	return summary, nil
+}
+
+// inTestFile は obj が移動するテストファイル自身で宣言されているかを返す
+func (e *externalizer) inTestFile(obj types.Object) bool {
+	return e.fs.Position(obj.Pos()).Filename == e.testFile
+}
+
+func (e *externalizer) errorf(pos token.Pos, format string, args ...any) {
+	e.errs = append(e.errs, fmt.Sprintf("%s: %s", e.fs.Position(pos), fmt.Sprintf(format, args...)))
+}
+
+// checkDecls はテストファイルの宣言が移動後も成り立つかを確認する
+func (e *externalizer) checkDecls(pkgs []*packages.Package) {
+	info := e.pkg.TypesInfo
+	for ident, obj := range info.Defs {
+		if obj != nil && ident.Name == e.pkg.Name && e.inTestFile(obj) {
+			e.errorf(ident.Pos(), "%s shadows the package name", ident.Name)
+		}
+	}
+
+	// パッケージの型へのメソッドは外部テストパッケージでは定義できない
+	for _, decl := range e.file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		obj, ok := info.Defs[fn.Name].(*types.Func)
+		if !ok {
+			continue
+		}
+		if named := namedOf(obj.Type().(*types.Signature).Recv().Type()); named != nil && !e.inTestFile(named.Obj()) {
+			e.errorf(fn.Pos(), "method %s is declared on %s of the package under test", fn.Name.Name, named.Obj().Name())
+		}
+	}
+
+	// 同じパッケージの他のテストファイルから使われている宣言は移動できない
+	for _, file := range e.pkg.Syntax {
+		if e.fs.Position(file.Pos()).Filename == e.testFile {
+			continue
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if obj := info.Uses[ident]; obj != nil && obj.Pkg() == e.pkg.Types && e.inTestFile(obj) {
+				e.errorf(ident.Pos(), "%s declared in %s is used by the package", ident.Name, filepath.Base(e.testFile))
+			}
+			return true
+		})
+	}
+
+	// 既存の外部テストパッケージと宣言が衝突しないか
+	scope := e.pkg.Types.Scope()
+	for _, pkg := range pkgs {
+		if pkg.Name != e.pkg.Name+"_test" || pkg.Types == nil || pkg.PkgPath != e.pkg.PkgPath+"_test" {
+			continue
+		}
+		for _, name := range scope.Names() {
+			obj := scope.Lookup(name)
+			if !e.inTestFile(obj) || name == "_" || name == "init" {
+				continue
+			}
+			if other := pkg.Types.Scope().Lookup(name); other != nil {
+				e.errorf(obj.Pos(), "%s is already declared in %s", name, e.fs.Position(other.Pos()))
+			}
+		}
+	}
+}
+
+// rewrite はパッケージレベルの参照を修飾し、非公開のシンボルを生成する公開名に置き換える
+func (e *externalizer) rewrite() {
+	info := e.pkg.TypesInfo
+	pkgName := e.pkg.Name
+	astutil.Apply(e.file, nil, func(c *astutil.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.CompositeLit:
+			e.checkLiteral(n)
+		case *ast.SelectorExpr:
+			e.rewriteSelector(n)
+		case *ast.UnaryExpr:
+			// &x は公開したポインタそのものにする。テストに元からある &*p はそのまま残す
+			if star, ok := n.X.(*ast.StarExpr); ok && n.Op == token.AND && e.derefs[star] {
+				c.Replace(star.X)
+			}
+		case *ast.Ident:
+			if _, ok := c.Parent().(*ast.SelectorExpr); ok && c.Name() == "Sel" {
+				return true
+			}
+			obj := info.Uses[n]
+			if obj == nil || obj.Pkg() != e.pkg.Types || obj.Parent() != e.pkg.Types.Scope() || e.inTestFile(obj) {
+				return true
+			}
+			e.references++
+			if obj.Exported() {
+				c.Replace(&ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(n.Name)})
+				return true
+			}
+			name := e.shim(n, obj)
+			if name == "" {
+				return true
+			}
+			var expr ast.Expr = &ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(name)}
+			if _, ok := obj.(*types.Var); ok {
+				// 変数はポインタを公開し、参照元で間接参照して読み書きを保つ
+				star := &ast.StarExpr{X: expr}
+				e.derefs[star] = true
+				expr = star
+				switch c.Parent().(type) {
+				case *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr, *ast.CallExpr, *ast.SliceExpr, *ast.TypeAssertExpr, *ast.StarExpr:
+					if c.Name() == "X" || c.Name() == "Fun" {
+						expr = &ast.ParenExpr{X: expr}
+					}
+				}
+			}
+			c.Replace(expr)
+		}
+		return true
+	})
+}
+
+// shimName は非公開のシンボルに対して生成する公開名を返す
+func (e *externalizer) shimName(name string) string {
+	return capitalizeFirst(name) + e.suffix
+}
+
+// qualifier は export_test.go に生成するコードの型の修飾子
+func (e *externalizer) qualifier(p *types.Package) string {
+	if p == e.pkg.Types {
+		return ""
+	}
+	e.imports[p.Path()] = ""
+	return p.Name()
+}
+
+// shim はパッケージレベルの非公開のシンボルを公開する宣言を登録し、その名前を返す
+func (e *externalizer) shim(ident *ast.Ident, obj types.Object) string {
+	name := e.shimName(obj.Name())
+	if existing := e.pkg.Types.Scope().Lookup(name); existing != nil {
+		// 以前の実行などで生成済み。同じ名前の別の宣言は使えない
+		if !matchesShim(existing, obj) {
+			e.errorf(ident.Pos(), "%s is already declared in %s and does not expose %s", name, e.fs.Position(existing.Pos()), obj.Name())
+			return ""
+		}
+		return name
+	}
+	switch obj := obj.(type) {
+	case *types.Const:
+		e.shims[name] = fmt.Sprintf("const %s = %s\n", name, obj.Name())
+	case *types.Var:
+		e.shims[name] = fmt.Sprintf("var %s = &%s\n", name, obj.Name())
+	case *types.TypeName:
+		if named, ok := obj.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+			e.errorf(ident.Pos(), "generic type %s cannot be aliased", obj.Name())
+			return ""
+		}
+		e.shims[name] = fmt.Sprintf("type %s = %s\n", name, obj.Name())
+	case *types.Func:
+		sig := obj.Type().(*types.Signature)
+		if sig.TypeParams().Len() == 0 {
+			e.shims[name] = fmt.Sprintf("var %s = %s\n", name, obj.Name())
+			break
+		}
+		e.shims[name] = forwardFunc("", name, obj.Name(), sig, e.qualifier)
+	default:
+		e.errorf(ident.Pos(), "unsupported reference to %s", obj.Name())
+		return ""
+	}
+	return name
+}
+
+// matchesShim は宣言済みの existing が、obj に対して生成する宣言と同じ種類・型かを判定する
+func matchesShim(existing, obj types.Object) bool {
+	switch obj := obj.(type) {
+	case *types.Const:
+		_, ok := existing.(*types.Const)
+		return ok && types.Identical(existing.Type(), obj.Type())
+	case *types.Var:
+		_, ok := existing.(*types.Var)
+		return ok && types.Identical(existing.Type(), types.NewPointer(obj.Type()))
+	case *types.TypeName:
+		alias, ok := existing.(*types.TypeName)
+		return ok && alias.IsAlias() && types.Identical(existing.Type(), obj.Type())
+	case *types.Func:
+		// 関数を代入した変数か、呼び出しを転送する関数
+		switch existing.(type) {
+		case *types.Var, *types.Func:
+			return types.Identical(existing.Type(), obj.Type())
+		}
+	}
+	return false
+}
+
+// rewriteSelector は非公開のメソッドの呼び出しを生成するメソッドに置き換える
+// 非公開のフィールドへのアクセスは外部から置き換えられないためエラーにする
+func (e *externalizer) rewriteSelector(sel *ast.SelectorExpr) {
+	selection := e.pkg.TypesInfo.Selections[sel]
+	if selection == nil {
+		return
+	}
+	obj := selection.Obj()
+	if obj.Exported() || obj.Pkg() != e.pkg.Types || e.inTestFile(obj) {
+		return
+	}
+	switch obj := obj.(type) {
+	case *types.Var:
+		e.errorf(sel.Sel.Pos(), "unexported field %s cannot be accessed from the external test package", obj.Name())
+	case *types.Func:
+		sig := obj.Type().(*types.Signature)
+		named := namedOf(sig.Recv().Type())
+		if named == nil || types.IsInterface(named) {
+			e.errorf(sel.Sel.Pos(), "unexported interface method %s cannot be accessed from the external test package", obj.Name())
+			return
+		}
+		name := e.shimName(obj.Name())
+		e.references++
+		sel.Sel = ast.NewIdent(name)
+		key := named.Obj().Name() + "." + name
+		if existing, _, _ := types.LookupFieldOrMethod(named, true, e.pkg.Types, name); existing != nil {
+			if _, ok := existing.(*types.Func); !ok || !types.Identical(existing.Type(), sig) {
+				e.errorf(sel.Sel.Pos(), "%s is already declared in %s and does not forward to %s", name, e.fs.Position(existing.Pos()), obj.Name())
+			}
+			return
+		}
+		recvType := named.Obj().Name()
+		if tparams := named.TypeParams(); tparams.Len() > 0 {
+			var args []string
+			for i := 0; i < tparams.Len(); i++ {
+				args = append(args, tparams.At(i).Obj().Name())
+			}
+			recvType += "[" + strings.Join(args, ", ") + "]"
+		}
+		if _, ok := sig.Recv().Type().(*types.Pointer); ok {
+			recvType = "*" + recvType
+		}
+		e.shims[key] = forwardFunc("(r "+recvType+")", name, "r."+obj.Name(), sig, e.qualifier)
+	}
+}
+
+// checkLiteral はパッケージの非公開フィールドを持つ構造体のリテラルがあるかを記録する
+func (e *externalizer) checkLiteral(cl *ast.CompositeLit) {
+	tv, ok := e.pkg.TypesInfo.Types[cl]
+	if !ok {
+		return
+	}
+	named := namedOf(tv.Type)
+	if named == nil || named.Obj().Pkg() != e.pkg.Types || e.inTestFile(named.Obj()) {
+		return
+	}
+	st, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if !st.Field(i).Exported() {
+			e.hasLiterals = true
+			return
+		}
+	}
+}
+
+// forwardFunc は call を呼び出すだけの関数を sig のシグネチャで生成する
+func forwardFunc(recv, name, call string, sig *types.Signature, qualifier types.Qualifier) string {
+	var typeParams, typeArgs []string
+	if recv == "" {
+		for i := 0; i < sig.TypeParams().Len(); i++ {
+			tp := sig.TypeParams().At(i)
+			typeParams = append(typeParams, tp.Obj().Name()+" "+types.TypeString(tp.Constraint(), qualifier))
+			typeArgs = append(typeArgs, tp.Obj().Name())
+		}
+	}
+	var params, args []string
+	for i := 0; i < sig.Params().Len(); i++ {
+		p := fmt.Sprintf("p%d", i)
+		t := sig.Params().At(i).Type()
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			params = append(params, p+" ..."+types.TypeString(t.(*types.Slice).Elem(), qualifier))
+			args = append(args, p+"...")
+			continue
+		}
+		params = append(params, p+" "+types.TypeString(t, qualifier))
+		args = append(args, p)
+	}
+	var results []string
+	for i := 0; i < sig.Results().Len(); i++ {
+		results = append(results, types.TypeString(sig.Results().At(i).Type(), qualifier))
+	}
+
+	var b strings.Builder
+	b.WriteString("func ")
+	if recv != "" {
+		b.WriteString(recv + " ")
+	}
+	b.WriteString(name)
+	if len(typeParams) > 0 {
+		b.WriteString("[" + strings.Join(typeParams, ", ") + "]")
+		call += "[" + strings.Join(typeArgs, ", ") + "]"
+	}
+	b.WriteString("(" + strings.Join(params, ", ") + ")")
+	switch len(results) {
+	case 0:
+	case 1:
+		b.WriteString(" " + results[0])
+	default:
+		b.WriteString(" (" + strings.Join(results, ", ") + ")")
+	}
+	b.WriteString(" {\n\t")
+	if len(results) > 0 {
+		b.WriteString("return ")
+	}
+	b.WriteString(call + "(" + strings.Join(args, ", ") + ")\n}\n")
+	return b.String()
+}
+
+// writeShims は生成した宣言を export_test.go に追記する
+func (e *externalizer) writeShims(journal *Journal) error {
+	filePath := filepath.Join(filepath.Dir(e.testFile), "export_test.go")
+	src, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		src, err = []byte("package "+e.pkg.Name+"\n"), nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+
+	var buf strings.Builder
+	buf.Write(src)
+	for _, name := range slices.Sorted(maps.Keys(e.shims)) {
+		buf.WriteString("\n")
+		buf.WriteString(e.shims[name])
+	}
+	code, err := addImports(filePath, buf.String(), e.imports)
+	if err != nil {
+		return err
+	}
+
+	if err := journal.RecordFile(filePath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, []byte(code), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filePath, err)
+	}
+	slog.Debug("wrote shims", slog.String("file", filePath), slog.Int("shims", len(e.shims)))
+	return nil
+}
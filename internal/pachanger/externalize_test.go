@@ -0,0 +1,113 @@
+package pachanger_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExternalizeTest(t *testing.T) {
+	files := map[string]string{
+		"foo/foo.go": `package foo
+
+const limit = 3
+
+var counter int
+
+var Ptr = new(int)
+
+type point struct{ X, Y int }
+
+type Server struct {
+	name string
+}
+
+func (s *Server) reset(n int) int { return n }
+
+func Exported() int { return limit }
+`,
+	}
+
+	t.Run("外部テストパッケージに移せる場合", func(t *testing.T) {
+		files["foo/foo_test.go"] = `package foo
+
+import "testing"
+
+func TestFoo(t *testing.T) {
+	s := &Server{name: "a"}
+	counter++
+	_ = point{X: 1}
+	_ = s.reset(limit) + Exported()
+	_, _ = &counter, &*Ptr
+}
+`
+		workDir := writeModule(t, files)
+		testFile := filepath.Join(workDir, "foo/foo_test.go")
+
+		summary, err := pachanger.ExternalizeTest(nil, workDir, testFile, "ForTest", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 8, summary.References)
+		assert.Equal(t, 1, summary.Literals)
+
+		got, err := os.ReadFile(testFile)
+		assert.NoError(t, err)
+		assert.Equal(t, `package foo_test
+
+import (
+	"testing"
+
+	"example.com/mod/foo"
+)
+
+func TestFoo(t *testing.T) {
+	s := foo.NewServerForTest(&foo.ServerParamsForTest{Name: "a"})
+	*foo.CounterForTest++
+	_ = foo.PointForTest{X: 1}
+	_ = s.ResetForTest(foo.LimitForTest) + foo.Exported()
+	_, _ = foo.CounterForTest, &*foo.Ptr
+}
+`, string(got))
+
+		shims, err := os.ReadFile(filepath.Join(workDir, "foo/export_test.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(shims), "var CounterForTest = &counter\n")
+		assert.Contains(t, string(shims), "const LimitForTest = limit\n")
+		assert.Contains(t, string(shims), "type PointForTest = point\n")
+		assert.Contains(t, string(shims), "func (r *Server) ResetForTest(p0 int) int {\n\treturn r.reset(p0)\n}\n")
+		assert.Contains(t, string(shims), "func NewServerForTest(params *ServerParamsForTest) *Server {")
+	})
+
+	t.Run("非公開のフィールドを参照している場合", func(t *testing.T) {
+		files["foo/foo_test.go"] = `package foo
+
+import "testing"
+
+func TestFoo(t *testing.T) {
+	s := Server{}
+	_ = s.name
+}
+`
+		workDir := writeModule(t, files)
+		_, err := pachanger.ExternalizeTest(nil, workDir, filepath.Join(workDir, "foo/foo_test.go"), "ForTest", nil)
+		assert.ErrorContains(t, err, "unexported field name cannot be accessed from the external test package")
+	})
+
+	t.Run("同じ名前で別の宣言がある場合", func(t *testing.T) {
+		files["foo/foo_test.go"] = `package foo
+
+import "testing"
+
+func TestFoo(t *testing.T) {
+	counter++
+}
+`
+		files["foo/export_test.go"] = "package foo\n\nvar CounterForTest = counter\n"
+		defer delete(files, "foo/export_test.go")
+		workDir := writeModule(t, files)
+		_, err := pachanger.ExternalizeTest(nil, workDir, filepath.Join(workDir, "foo/foo_test.go"), "ForTest", nil)
+		assert.ErrorContains(t, err, "CounterForTest is already declared in "+filepath.Join(workDir, "foo/export_test.go")+":3:5 and does not expose counter")
+	})
+}
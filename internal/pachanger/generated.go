@@ -0,0 +1,170 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// GeneratedPolicy は "// Code generated ... DO NOT EDIT." のヘッダーを持つファイルの扱い
+type GeneratedPolicy string
+
+const (
+	// GeneratedRewrite は生成されたファイルも他のファイルと同様に書き換える
+	GeneratedRewrite GeneratedPolicy = "rewrite"
+	// GeneratedSkip は生成されたファイルを書き換えず、壊れる参照を報告する
+	GeneratedSkip GeneratedPolicy = "skip"
+	// GeneratedRegenerate は生成されたファイルを書き換え、再実行が必要な生成コマンドを報告する
+	GeneratedRegenerate GeneratedPolicy = "regenerate"
+)
+
+// ParseGeneratedPolicy は --generated フラグの値を解析する
+func ParseGeneratedPolicy(s string) (GeneratedPolicy, error) {
+	switch policy := GeneratedPolicy(s); policy {
+	case GeneratedRewrite, GeneratedSkip, GeneratedRegenerate:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown generated policy %q: must be one of rewrite, skip, regenerate", s)
+}
+
+// SetGeneratedPolicy は生成されたファイルの扱いを変更する
+func (t *Transformer) SetGeneratedPolicy(policy GeneratedPolicy) {
+	t.generatedPolicy = policy
+}
+
+// GeneratedFile は移動したシンボルを参照している生成されたファイル
+type GeneratedFile struct {
+	File string
+	// ヘッダーに書かれた生成元。"by protoc-gen-go" など
+	Generator string
+	// 書き換えたか。書き換えなかった場合は References の参照が壊れる
+	Rewritten  bool
+	References []SkippedReference
+	// ファイルを生成している go:generate コマンド。GeneratedRewrite の場合は探さない
+	Commands []GenerateCommand
+}
+
+// GenerateCommand は go:generate で実行されるコマンドと、実行されるディレクトリ
+type GenerateCommand struct {
+	Dir     string
+	Command string
+}
+
+func (c GenerateCommand) String() string {
+	return fmt.Sprintf("(cd %s && %s)", c.Dir, c.Command)
+}
+
+// GeneratedFiles は移動したシンボルを参照している生成されたファイルの一覧を返す
+// 生成コマンドは書き換えた後の go:generate から探すため、すべてのファイルを処理した後に呼び出す
+func (t *Transformer) GeneratedFiles() []GeneratedFile {
+	t.skippedMutex.Lock()
+	defer t.skippedMutex.Unlock()
+	files := make([]GeneratedFile, 0, len(t.generatedFiles))
+	for _, f := range t.generatedFiles {
+		generated := *f
+		if t.generatedPolicy != GeneratedRewrite {
+			generated.Commands = t.generateCommandsFor(f.File, f.Generator)
+		}
+		files = append(files, generated)
+	}
+	slices.SortFunc(files, func(a, b GeneratedFile) int { return strings.Compare(a.File, b.File) })
+	return files
+}
+
+// recordGenerated は生成されたファイルを記録する。複数のターゲットで参照されている場合はまとめる
+func (t *Transformer) recordGenerated(target string, file *ast.File, rewritten bool, refs []SkippedReference) {
+	t.skippedMutex.Lock()
+	defer t.skippedMutex.Unlock()
+	if t.generatedFiles == nil {
+		t.generatedFiles = map[string]*GeneratedFile{}
+	}
+	generated, ok := t.generatedFiles[target]
+	if !ok {
+		generated = &GeneratedFile{
+			File:      target,
+			Generator: generatorName(file),
+		}
+		t.generatedFiles[target] = generated
+	}
+	generated.Rewritten = generated.Rewritten || rewritten
+	generated.References = append(generated.References, refs...)
+}
+
+var generatedHeader = regexp.MustCompile(`^// Code generated (.*?)\s*DO NOT EDIT\.$`)
+
+// generatorName は生成されたファイルのヘッダーから生成元を返す
+func generatorName(file *ast.File) string {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if m := generatedHeader.FindStringSubmatch(c.Text); m != nil {
+				return strings.TrimRight(m[1], ".;")
+			}
+		}
+	}
+	return ""
+}
+
+// generateCommandsFor は filename を生成している go:generate コマンドを探す
+// 引数で filename を指しているものを優先し、見つからなければ同じディレクトリにある、生成元の名前を含むコマンドを返す
+func (t *Transformer) generateCommandsFor(filename, generator string) []GenerateCommand {
+	var byPath, byName []GenerateCommand
+	seen := map[string]bool{}
+	for _, pkg := range t.allPkgs {
+		for _, file := range pkg.Syntax {
+			source := t.fs.Position(file.Pos()).Filename
+			if seen[source] {
+				continue
+			}
+			seen[source] = true
+			dir := t.finalDir(source, false)
+			for _, group := range file.Comments {
+				for _, c := range group.List {
+					command, ok := strings.CutPrefix(c.Text, "//go:generate ")
+					if !ok {
+						continue
+					}
+					cmd := GenerateCommand{Dir: dir, Command: strings.TrimSpace(command)}
+					words := strings.Fields(command)
+					if slices.ContainsFunc(words, func(word string) bool {
+						if _, value, ok := strings.Cut(word, "="); ok && strings.HasPrefix(word, "-") {
+							word = value
+						}
+						return filepath.Join(dir, filepath.FromSlash(word)) == filename
+					}) {
+						byPath = append(byPath, cmd)
+					} else if name := commandName(words); dir == filepath.Dir(filename) && name != "" && generator != "" &&
+						strings.Contains(strings.ToLower(generator), strings.ToLower(name)) {
+						byName = append(byName, cmd)
+					}
+				}
+			}
+		}
+	}
+	if len(byPath) > 0 {
+		return byPath
+	}
+	return byName
+}
+
+// commandName は go:generate で実行するコマンドの名前を返す。"go run pkg@version" の場合は pkg の末尾の要素を返す
+func commandName(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	name := words[0]
+	if name == "go" {
+		if len(words) < 3 || words[1] != "run" {
+			return ""
+		}
+		name = words[2]
+	}
+	name, _, _ = strings.Cut(path.Base(name), "@")
+	return name
+}
@@ -0,0 +1,56 @@
+package pachanger_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratedPolicy(t *testing.T) {
+	files := map[string]string{
+		"model/user.go": "package model\n\ntype User struct{ Name string }\n",
+		"model/base.go": "package model\n\ntype Base struct{}\n",
+		"api/gen.go":    "package api\n\n//go:generate stringer -type=Kind -output=api_gen.go\n\ntype Kind int\n",
+		"api/api_gen.go": "// Code generated by stringer; DO NOT EDIT.\n\npackage api\n\n" +
+			"import \"example.com/mod/model\"\n\nvar U model.User\n",
+	}
+
+	transform := func(t *testing.T, policy pachanger.GeneratedPolicy) (string, *pachanger.Transformer, func(string) string) {
+		cfg := moveConfig{setup: func(transformer *pachanger.Transformer) { transformer.SetGeneratedPolicy(policy) }}
+		return moveAndRead(t, files, cfg, "model/user.go", "model/user/user.go", "model/base.go", "api/gen.go", "api/api_gen.go")
+	}
+
+	t.Run("生成されたファイルを書き換えない場合", func(t *testing.T) {
+		workDir, transformer, read := transform(t, pachanger.GeneratedSkip)
+		assert.Equal(t, files["api/api_gen.go"], read("api/api_gen.go"))
+		generated := transformer.GeneratedFiles()
+		if assert.Len(t, generated, 1) {
+			assert.Equal(t, filepath.Join(workDir, "api/api_gen.go"), generated[0].File)
+			assert.Equal(t, "by stringer", generated[0].Generator)
+			assert.False(t, generated[0].Rewritten)
+			assert.Len(t, generated[0].References, 1)
+			assert.Equal(t, []pachanger.GenerateCommand{{Dir: filepath.Join(workDir, "api"), Command: "stringer -type=Kind -output=api_gen.go"}}, generated[0].Commands)
+		}
+	})
+
+	t.Run("書き換えて生成コマンドを報告する場合", func(t *testing.T) {
+		_, transformer, read := transform(t, pachanger.GeneratedRegenerate)
+		assert.Contains(t, read("api/api_gen.go"), "var U user.User\n")
+		generated := transformer.GeneratedFiles()
+		if assert.Len(t, generated, 1) {
+			assert.True(t, generated[0].Rewritten)
+			assert.Len(t, generated[0].Commands, 1)
+		}
+	})
+
+	t.Run("書き換える場合", func(t *testing.T) {
+		_, transformer, read := transform(t, pachanger.GeneratedRewrite)
+		assert.Contains(t, read("api/api_gen.go"), "var U user.User\n")
+		generated := transformer.GeneratedFiles()
+		if assert.Len(t, generated, 1) {
+			assert.Empty(t, generated[0].Commands)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package pachanger
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitChangedFiles は rev 以降に変更されたファイル(未追跡のファイルを含む)の絶対パスを返す
+func GitChangedFiles(workDir, rev string) ([]string, error) {
+	root, err := gitOutput(workDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root = strings.TrimSpace(root)
+
+	diff, err := gitOutput(root, "diff", "--name-only", rev, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitOutput(root, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(diff+"\n"+untracked, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		abs := filepath.Join(root, line)
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		files = append(files, abs)
+	}
+	return files, nil
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s failed: %w", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
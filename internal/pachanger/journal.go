@@ -0,0 +1,300 @@
+package pachanger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalDir はモジュールルートに作成するジャーナルの保存先
+const JournalDir = ".pachanger"
+
+// JournalFile は実行中に書き換えたファイルの変更前の状態
+type JournalFile struct {
+	Path     string `json:"path"`
+	Existed  bool   `json:"existed"`
+	Original []byte `json:"original,omitempty"`
+	// 実行後の内容のハッシュ。undo時に後から変更されていないかの確認に使う
+	Hash string `json:"hash,omitempty"`
+}
+
+// JournalMove は移動したファイルの記録
+type JournalMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Journal は1回の実行で行った変更の記録
+// nilのJournalに対する記録は何もしないため、ジャーナルを使わない呼び出し元はnilを渡せばよい
+type Journal struct {
+	ID          string         `json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Args        []string       `json:"args"`
+	Files       []*JournalFile `json:"files"`
+	Moves       []JournalMove  `json:"moves,omitempty"`
+	Deleted     []string       `json:"deleted,omitempty"`
+	CreatedDirs []string       `json:"created_dirs,omitempty"`
+	Undone      bool           `json:"undone"`
+
+	root  string
+	mu    sync.Mutex
+	index map[string]*JournalFile
+}
+
+// NewJournal はworkDirの属するモジュールに保存するジャーナルを生成する
+func NewJournal(workDir string, args []string) (*Journal, error) {
+	root, err := findGoModDir(workDir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Journal{
+		ID:        now.Format("20060102-150405.000000"),
+		CreatedAt: now,
+		Args:      args,
+		root:      root,
+		index:     map[string]*JournalFile{},
+	}, nil
+}
+
+// RecordFile はファイルを書き換える前に呼び出し、変更前の内容を記録する
+// 同じファイルは最初の呼び出し時点の内容のみを保持する
+func (j *Journal) RecordFile(path string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.recordFile(path)
+}
+
+func (j *Journal) recordFile(path string) error {
+	if _, ok := j.index[path]; ok {
+		return nil
+	}
+	f := &JournalFile{Path: path}
+	src, err := os.ReadFile(path)
+	if err == nil {
+		f.Existed = true
+		f.Original = src
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to record %s: %w", path, err)
+	}
+	j.index[path] = f
+	j.Files = append(j.Files, f)
+	return nil
+}
+
+// RecordMove はファイルの移動を記録する。移動元と移動先の内容も記録される
+func (j *Journal) RecordMove(from, to string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.recordFile(from); err != nil {
+		return err
+	}
+	if err := j.recordFile(to); err != nil {
+		return err
+	}
+	j.Moves = append(j.Moves, JournalMove{From: from, To: to})
+	return nil
+}
+
+// Remove はファイルの内容を記録してから削除する
+func (j *Journal) Remove(path string) error {
+	if j != nil {
+		j.mu.Lock()
+		err := j.recordFile(path)
+		if _, statErr := os.Stat(path); err == nil && statErr == nil {
+			j.Deleted = append(j.Deleted, path)
+		}
+		j.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+// MkdirAll は新しく作成したディレクトリを記録してから作成する
+func (j *Journal) MkdirAll(dir string) error {
+	if j != nil {
+		var created []string
+		for d := dir; ; d = filepath.Dir(d) {
+			if _, err := os.Stat(d); err == nil {
+				break
+			}
+			created = append(created, d)
+			if filepath.Dir(d) == d {
+				break
+			}
+		}
+		j.mu.Lock()
+		// 親から順に記録し、undoでは逆順に削除する
+		for i := len(created) - 1; i >= 0; i-- {
+			j.CreatedDirs = append(j.CreatedDirs, created[i])
+		}
+		j.mu.Unlock()
+	}
+	return os.MkdirAll(dir, 0o755)
+}
+
+// Save は実行後の内容のハッシュを計算してジャーナルを保存する
+// 何も変更していない場合は保存しない
+func (j *Journal) Save() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.Files) == 0 && len(j.CreatedDirs) == 0 {
+		return nil
+	}
+	for _, f := range j.Files {
+		f.Hash = fileHash(f.Path)
+	}
+	return j.write()
+}
+
+func (j *Journal) write() error {
+	dir := filepath.Join(j.root, JournalDir, "journal")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, j.ID+".json"), b, 0o644); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// Undo はジャーナルに記録された変更を元に戻す
+// 実行後に他の変更が加えられたファイルがある場合は、force が指定されない限りエラーにする
+func (j *Journal) Undo(force bool) error {
+	if j.Undone {
+		return fmt.Errorf("run %s is already undone", j.ID)
+	}
+
+	if !force {
+		var conflicts []string
+		for _, f := range j.Files {
+			if fileHash(f.Path) != f.Hash {
+				conflicts = append(conflicts, f.Path)
+			}
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("files changed after run %s (use --force to overwrite): %s", j.ID, strings.Join(conflicts, ", "))
+		}
+	}
+
+	for i := len(j.Files) - 1; i >= 0; i-- {
+		f := j.Files[i]
+		if !f.Existed {
+			if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", f.Path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", f.Path, err)
+		}
+		if err := os.WriteFile(f.Path, f.Original, 0o644); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", f.Path, err)
+		}
+	}
+
+	// 作成したディレクトリは空の場合のみ削除する
+	for i := len(j.CreatedDirs) - 1; i >= 0; i-- {
+		dir := j.CreatedDirs[i]
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dir); err != nil {
+			return fmt.Errorf("failed to remove directory %s: %w", dir, err)
+		}
+	}
+
+	j.Undone = true
+	return j.write()
+}
+
+// LoadJournals はworkDirの属するモジュールに保存されたジャーナルを古い順に返す
+func LoadJournals(workDir string) ([]*Journal, error) {
+	root, err := findGoModDir(workDir)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, JournalDir, "journal")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read journal directory: %w", err)
+	}
+
+	var journals []*Journal
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal %s: %w", e.Name(), err)
+		}
+		j := &Journal{}
+		if err := json.Unmarshal(b, j); err != nil {
+			return nil, fmt.Errorf("failed to parse journal %s: %w", e.Name(), err)
+		}
+		j.root = root
+		journals = append(journals, j)
+	}
+	sort.Slice(journals, func(a, b int) bool {
+		return journals[a].ID < journals[b].ID
+	})
+	return journals, nil
+}
+
+// LoadJournal はidに一致するジャーナルを返す。idが空の場合は取り消されていない最新のものを返す
+func LoadJournal(workDir, id string) (*Journal, error) {
+	journals, err := LoadJournals(workDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(journals) - 1; i >= 0; i-- {
+		j := journals[i]
+		if id == "" && !j.Undone {
+			return j, nil
+		}
+		if id != "" && j.ID == id {
+			return j, nil
+		}
+	}
+	if id == "" {
+		return nil, fmt.Errorf("no run to undo")
+	}
+	return nil, fmt.Errorf("run %s not found", id)
+}
+
+func fileHash(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,86 @@
+package pachanger_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalUndo(t *testing.T) {
+	workDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "go.mod"), []byte("module example.com/journal\n"), 0644))
+
+	modifiedPath := filepath.Join(workDir, "modified.go")
+	removedPath := filepath.Join(workDir, "removed.go")
+	createdDir := filepath.Join(workDir, "newpkg", "sub")
+	createdPath := filepath.Join(createdDir, "created.go")
+	assert.NoError(t, os.WriteFile(modifiedPath, []byte("package a\n"), 0644))
+	assert.NoError(t, os.WriteFile(removedPath, []byte("package a\n\nvar X = 1\n"), 0644))
+
+	journal, err := pachanger.NewJournal(workDir, []string{"--file", "removed.go"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, journal.RecordFile(modifiedPath))
+	assert.NoError(t, os.WriteFile(modifiedPath, []byte("package b\n"), 0644))
+	assert.NoError(t, journal.MkdirAll(createdDir))
+	assert.NoError(t, journal.RecordMove(removedPath, createdPath))
+	assert.NoError(t, os.WriteFile(createdPath, []byte("package sub\n\nvar X = 1\n"), 0644))
+	assert.NoError(t, journal.Remove(removedPath))
+	assert.NoError(t, journal.Save())
+
+	journals, err := pachanger.LoadJournals(workDir)
+	assert.NoError(t, err)
+	assert.Len(t, journals, 1)
+	assert.Equal(t, journal.ID, journals[0].ID)
+	assert.Equal(t, []string{removedPath}, journals[0].Deleted)
+
+	latest, err := pachanger.LoadJournal(workDir, "")
+	assert.NoError(t, err)
+	assert.NoError(t, latest.Undo(false))
+
+	b, err := os.ReadFile(modifiedPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "package a\n", string(b))
+	b, err = os.ReadFile(removedPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "package a\n\nvar X = 1\n", string(b))
+	_, err = os.Stat(filepath.Join(workDir, "newpkg"))
+	assert.True(t, os.IsNotExist(err))
+
+	// 取り消し済みの実行は再度取り消せない
+	_, err = pachanger.LoadJournal(workDir, "")
+	assert.Error(t, err)
+	undone, err := pachanger.LoadJournal(workDir, journal.ID)
+	assert.NoError(t, err)
+	assert.True(t, undone.Undone)
+	assert.Error(t, undone.Undo(false))
+}
+
+func TestJournalUndoConflict(t *testing.T) {
+	workDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(workDir, "go.mod"), []byte("module example.com/journal\n"), 0644))
+
+	path := filepath.Join(workDir, "a.go")
+	assert.NoError(t, os.WriteFile(path, []byte("package a\n"), 0644))
+
+	journal, err := pachanger.NewJournal(workDir, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, journal.RecordFile(path))
+	assert.NoError(t, os.WriteFile(path, []byte("package b\n"), 0644))
+	assert.NoError(t, journal.Save())
+
+	// 実行後に変更されたファイルがある場合はforceなしでは戻さない
+	assert.NoError(t, os.WriteFile(path, []byte("package c\n"), 0644))
+	assert.Error(t, journal.Undo(false))
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "package c\n", string(b))
+
+	assert.NoError(t, journal.Undo(true))
+	b, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "package a\n", string(b))
+}
@@ -0,0 +1,113 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MergePlan は fromDir のパッケージを intoDir のパッケージへ統合する計画
+type MergePlan struct {
+	PkgName string
+	IntoDir string
+	// 統合先のパッケージとして移動するファイル
+	Files []string
+	// 外部テストパッケージ(xxx_test)のファイル。パッケージ名を変えて移動する
+	ExternalTests []string
+}
+
+// PlanMerge は fromDir のパッケージを intoDir のパッケージへ統合する計画を立てる
+// 統合するとシンボルやファイル名が衝突する場合は、壊れたコードを生成せずにエラーを返す
+func PlanMerge(workDir, fromDir, intoDir string, buildFlags []string) (*MergePlan, error) {
+	fs := token.NewFileSet()
+	pkgs, err := loadPackages(fs, workDir, buildFlags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	from := findPackageByDir(fs, pkgs, fromDir)
+	if from == nil {
+		return nil, fmt.Errorf("package not found in %s", fromDir)
+	}
+	into := findPackageByDir(fs, pkgs, intoDir)
+	if into == nil {
+		return nil, fmt.Errorf("package not found in %s", intoDir)
+	}
+
+	var collisions []string
+	for _, name := range from.Types.Scope().Names() {
+		if name == "_" || name == "init" {
+			continue
+		}
+		if obj := into.Types.Scope().Lookup(name); obj != nil {
+			collisions = append(collisions, fmt.Sprintf("symbol %s is declared in both %s and %s", name, fs.Position(from.Types.Scope().Lookup(name).Pos()), fs.Position(obj.Pos())))
+		}
+	}
+
+	plan := &MergePlan{PkgName: into.Name, IntoDir: intoDir}
+	for _, file := range from.Syntax {
+		plan.Files = append(plan.Files, fs.Position(file.Pos()).Filename)
+	}
+
+	// 外部テストパッケージのファイルはパッケージ名を解析して探す
+	entries, err := os.ReadDir(fromDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fromDir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+		filename := filepath.Join(fromDir, e.Name())
+		f, err := parser.ParseFile(fs, filename, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		if f.Name.Name == from.Name+"_test" {
+			plan.ExternalTests = append(plan.ExternalTests, filename)
+		}
+	}
+
+	for _, f := range append(append([]string{}, plan.Files...), plan.ExternalTests...) {
+		dst := filepath.Join(intoDir, filepath.Base(f))
+		if _, err := os.Stat(dst); err == nil {
+			collisions = append(collisions, fmt.Sprintf("file %s already exists", dst))
+		}
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, fmt.Errorf("cannot merge %s into %s:\n%s", from.PkgPath, into.PkgPath, strings.Join(collisions, "\n"))
+	}
+	sort.Strings(plan.Files)
+	sort.Strings(plan.ExternalTests)
+	return plan, nil
+}
+
+// MoveExternalTest は外部テストパッケージのファイルを dst へ移動し、
+// パッケージ名を pkgName の外部テストパッケージに変更する
+func MoveExternalTest(journal *Journal, workDir, src, dst, pkgName string) error {
+	fs := token.NewFileSet()
+	node, err := parser.ParseFile(fs, src, nil, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", src, err)
+	}
+	node.Name.Name = pkgName + "_test"
+
+	restore, err := chdirGoModDir(workDir)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	if err := journal.RecordMove(src, dst); err != nil {
+		return err
+	}
+	if err := writeFile(fs, node, dst); err != nil {
+		return err
+	}
+	return journal.Remove(src)
+}
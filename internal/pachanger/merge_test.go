@@ -0,0 +1,42 @@
+package pachanger_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanMerge(t *testing.T) {
+	files := map[string]string{
+		"a/a.go":      "package a\n\nfunc Hello() string { return \"a\" }\n",
+		"a/a_test.go": "package a_test\n",
+		"b/b.go":      "package b\n\nfunc World() string { return \"b\" }\n",
+	}
+
+	t.Run("統合できる場合", func(t *testing.T) {
+		workDir := writeModule(t, files)
+		plan, err := pachanger.PlanMerge(workDir, filepath.Join(workDir, "a"), filepath.Join(workDir, "b"), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, &pachanger.MergePlan{
+			PkgName:       "b",
+			IntoDir:       filepath.Join(workDir, "b"),
+			Files:         []string{filepath.Join(workDir, "a/a.go")},
+			ExternalTests: []string{filepath.Join(workDir, "a/a_test.go")},
+		}, plan)
+	})
+
+	t.Run("シンボルが衝突する場合", func(t *testing.T) {
+		collided := map[string]string{}
+		for k, v := range files {
+			collided[k] = v
+		}
+		collided["b/a.go"] = "package b\n\nfunc Hello() string { return \"b\" }\n"
+		workDir := writeModule(t, collided)
+
+		_, err := pachanger.PlanMerge(workDir, filepath.Join(workDir, "a"), filepath.Join(workDir, "b"), nil)
+		assert.ErrorContains(t, err, "symbol Hello is declared in both")
+		assert.ErrorContains(t, err, "file "+filepath.Join(workDir, "b/a.go")+" already exists")
+	})
+}
@@ -0,0 +1,528 @@
+package pachanger
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// generatedFunc は migrate struct が生成した関数
+type generatedFunc struct {
+	structName string
+	// options 形式のオプション関数が設定するフィールド。コンストラクタの場合は空
+	field   string
+	builder bool
+}
+
+// RevertAll はモジュール内のすべてのテストファイルで、生成したコンストラクタの呼び出しを
+// 構造体リテラルに戻し、使われなくなった生成済みの宣言を削除する
+func (m *MigrateStruct) RevertAll() (*MigrateSummary, error) {
+	m.pkgs = nil
+	testFiles, err := m.testFiles()
+	if err != nil {
+		return nil, err
+	}
+	return m.revertFiles(testFiles)
+}
+
+// RevertFiles は指定したテストファイルのコンストラクタの呼び出しを構造体リテラルに戻す
+func (m *MigrateStruct) RevertFiles(testFiles []string) (*MigrateSummary, error) {
+	m.pkgs = nil
+	return m.revertFiles(testFiles)
+}
+
+func (m *MigrateStruct) revertFiles(testFiles []string) (*MigrateSummary, error) {
+	if err := m.resolveTargets(); err != nil {
+		return nil, err
+	}
+	StructDefs, err := m.FindStructDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	funcs := m.generatedFuncs(StructDefs)
+
+	restore, err := chdirGoModDir(m.workDir)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	// 往復テストなど生成したコードの中の呼び出しは戻さない
+	generated := map[string]bool{}
+	for _, StructDef := range StructDefs {
+		if m.isTarget(StructDef) {
+			for _, name := range m.generatedNames(StructDef) {
+				generated[name] = true
+			}
+		}
+	}
+
+	summary := &MigrateSummary{}
+	for _, testFile := range testFiles {
+		node, pkg, err := m.findFile(testFile)
+		if err != nil {
+			return nil, err
+		}
+		m.rewrites = 0
+		if !m.revertFile(node, pkg, funcs, StructDefs, generated) {
+			continue
+		}
+		if err := m.journal.RecordFile(testFile); err != nil {
+			return nil, err
+		}
+		if err := writeFile(m.fs, node, testFile); err != nil {
+			return nil, err
+		}
+		summary.Files = append(summary.Files, testFile)
+		summary.Literals += m.rewrites
+	}
+
+	removed, err := m.removeUnusedConstructors(StructDefs)
+	if err != nil {
+		return nil, err
+	}
+	summary.Constructors = removed
+	return summary, nil
+}
+
+// generatedFuncs は生成したコンストラクタとオプション関数を import path 付きの名前で引けるようにする
+// どの形式で生成したかは分からないため、すべての形式の名前を登録する
+func (m *MigrateStruct) generatedFuncs(StructDefs map[string]StructDef) map[string]generatedFunc {
+	funcs := map[string]generatedFunc{}
+	for structName, StructDef := range StructDefs {
+		if !m.isTarget(StructDef) {
+			continue
+		}
+		nakedStructName := StructDef.named.Obj().Name()
+		prefix := StructDef.pkgPath + "."
+		ctorName, _ := m.constructorNamesFor(StyleParams, nakedStructName)
+		builderName, _ := m.constructorNamesFor(StyleBuilder, nakedStructName)
+		funcs[prefix+ctorName] = generatedFunc{structName: structName}
+		funcs[prefix+builderName] = generatedFunc{structName: structName, builder: true}
+		for _, fieldName := range StructDef.fieldList {
+			funcs[prefix+m.optionFuncName(nakedStructName, fieldName)] = generatedFunc{structName: structName, field: fieldName}
+		}
+	}
+	return funcs
+}
+
+// generatedNames は構造体について生成しうる宣言の名前を返す
+func (m *MigrateStruct) generatedNames(StructDef StructDef) []string {
+	nakedStructName := StructDef.named.Obj().Name()
+	var names []string
+	for _, style := range []ConstructorStyle{StyleParams, StyleOptions, StyleBuilder} {
+		funcName, typeName := m.constructorNamesFor(style, nakedStructName)
+		names = append(names, funcName, typeName, "Test"+funcName+"RoundTrip")
+	}
+	for _, fieldName := range StructDef.fieldList {
+		names = append(names, m.optionFuncName(nakedStructName, fieldName))
+	}
+	return names
+}
+
+// calledFunc は呼び出している関数を import path 付きの名前で返す。メソッドの場合は空文字を返す
+func calledFunc(info *types.Info, fun ast.Expr) string {
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+	var ident *ast.Ident
+	switch f := fun.(type) {
+	case *ast.Ident:
+		ident = f
+	case *ast.SelectorExpr:
+		ident = f.Sel
+	default:
+		return ""
+	}
+	fn, ok := info.Uses[ident].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Type().(*types.Signature).Recv() != nil {
+		return ""
+	}
+	return fn.Pkg().Path() + "." + fn.Name()
+}
+
+// revertFile は node の中のコンストラクタの呼び出しを構造体リテラルに戻す
+func (m *MigrateStruct) revertFile(node *ast.File, pkg *packages.Package, funcs map[string]generatedFunc, StructDefs map[string]StructDef, generated map[string]bool) bool {
+	var modified bool
+	post := func(c *astutil.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.StarExpr:
+			// `*pkg.NewXXX(...)` は値のリテラルに戻す
+			call, ok := n.X.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if lit := m.revertCall(call, node, pkg, funcs, StructDefs); lit != nil {
+				c.Replace(lit)
+				modified = true
+				m.rewrites++
+			}
+		case *ast.CallExpr:
+			if star, ok := c.Parent().(*ast.StarExpr); ok && star.X == n {
+				return true
+			}
+			// コンストラクタはポインタを返すため、アドレス演算子を付けて型を保つ
+			if lit := m.revertCall(n, node, pkg, funcs, StructDefs); lit != nil {
+				c.Replace(&ast.UnaryExpr{Op: token.AND, X: lit})
+				modified = true
+				m.rewrites++
+			}
+		}
+		return true
+	}
+	for _, decl := range node.Decls {
+		if name, _ := generatedDeclName(decl); generated[name] {
+			continue
+		}
+		astutil.Apply(decl, nil, post)
+	}
+	return modified
+}
+
+// revertCall は params / options / builder のいずれかの形式の呼び出しを構造体リテラルに戻す
+// 引数を変数で渡しているなど、元のリテラルを復元できない場合は nil を返す
+func (m *MigrateStruct) revertCall(call *ast.CallExpr, file *ast.File, pkg *packages.Package, funcs map[string]generatedFunc, StructDefs map[string]StructDef) *ast.CompositeLit {
+	info := pkg.TypesInfo
+	structName, elts, ok := revertArgs(call, info, funcs, StructDefs)
+	if !ok {
+		return nil
+	}
+	tv, ok := info.Types[call]
+	if !ok {
+		return nil
+	}
+	named := namedOf(tv.Type)
+	if named == nil || typeKey(named.Origin().Obj()) != structName {
+		return nil
+	}
+	typeExpr, err := parser.ParseExpr(types.TypeString(named, fileQualifier(file, pkg)))
+	if err != nil {
+		return nil
+	}
+	return &ast.CompositeLit{Type: typeExpr, Elts: elts}
+}
+
+// revertArgs は呼び出しの引数から元の構造体リテラルの要素を組み立てる
+func revertArgs(call *ast.CallExpr, info *types.Info, funcs map[string]generatedFunc, StructDefs map[string]StructDef) (string, []ast.Expr, bool) {
+	// builder 形式: pkg.NewXXXBuilder().A(1).Build()
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Build" && len(call.Args) == 0 {
+		var setters []*ast.CallExpr
+		expr := sel.X
+		for {
+			inner, ok := expr.(*ast.CallExpr)
+			if !ok {
+				return "", nil, false
+			}
+			if g, ok := funcs[calledFunc(info, inner.Fun)]; ok && g.builder && len(inner.Args) == 0 {
+				fields := rawFieldNames(StructDefs[g.structName])
+				var elts []ast.Expr
+				for i := len(setters) - 1; i >= 0; i-- {
+					name := setters[i].Fun.(*ast.SelectorExpr).Sel.Name
+					fieldName, ok := fields[name]
+					if !ok || len(setters[i].Args) != 1 {
+						return "", nil, false
+					}
+					elts = append(elts, &ast.KeyValueExpr{Key: ast.NewIdent(fieldName), Value: setters[i].Args[0]})
+				}
+				return g.structName, elts, true
+			}
+			setter, ok := inner.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return "", nil, false
+			}
+			setters = append(setters, inner)
+			expr = setter.X
+		}
+	}
+
+	g, ok := funcs[calledFunc(info, call.Fun)]
+	if !ok || g.builder || g.field != "" {
+		return "", nil, false
+	}
+
+	// params 形式: pkg.NewXXX(&pkg.XXXParams{A: 1})
+	if len(call.Args) == 1 {
+		if u, ok := call.Args[0].(*ast.UnaryExpr); ok && u.Op == token.AND {
+			lit, ok := u.X.(*ast.CompositeLit)
+			if !ok {
+				return "", nil, false
+			}
+			fields := rawFieldNames(StructDefs[g.structName])
+			var elts []ast.Expr
+			for _, el := range lit.Elts {
+				kv, ok := el.(*ast.KeyValueExpr)
+				if !ok {
+					elts = append(elts, el)
+					continue
+				}
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok {
+					return "", nil, false
+				}
+				fieldName, ok := fields[key.Name]
+				if !ok {
+					return "", nil, false
+				}
+				elts = append(elts, &ast.KeyValueExpr{Key: ast.NewIdent(fieldName), Value: kv.Value})
+			}
+			return g.structName, elts, true
+		}
+	}
+
+	// options 形式: pkg.NewXXX(pkg.WithXXXA(1))
+	var elts []ast.Expr
+	for _, arg := range call.Args {
+		opt, ok := arg.(*ast.CallExpr)
+		if !ok || len(opt.Args) != 1 {
+			return "", nil, false
+		}
+		o, ok := funcs[calledFunc(info, opt.Fun)]
+		if !ok || o.structName != g.structName || o.field == "" {
+			return "", nil, false
+		}
+		elts = append(elts, &ast.KeyValueExpr{Key: ast.NewIdent(o.field), Value: opt.Args[0]})
+	}
+	return g.structName, elts, true
+}
+
+// rawFieldNames は公開名から元のフィールド名を引けるようにする
+func rawFieldNames(StructDef StructDef) map[string]string {
+	fields := map[string]string{}
+	for _, fieldName := range StructDef.fieldList {
+		fields[exportedFieldName(fieldName)] = fieldName
+	}
+	return fields
+}
+
+// removeUnusedConstructors は生成した宣言のうち、生成したコードの外から使われていないものを
+// 構造体ごとに削除し、削除した構造体を返す
+func (m *MigrateStruct) removeUnusedConstructors(StructDefs map[string]StructDef) ([]string, error) {
+	// テストファイルの書き換えを反映させるため読み込み直す
+	m.pkgs = nil
+	pkgs, err := m.loadedPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := map[string]map[string]string{} // import path -> 宣言名 -> 構造体名
+	shapes := map[string]map[string]bool{}   // 構造体名 -> 生成する宣言
+	for structName, StructDef := range StructDefs {
+		if !m.isTarget(StructDef) {
+			continue
+		}
+		if owners[StructDef.pkgPath] == nil {
+			owners[StructDef.pkgPath] = map[string]string{}
+		}
+		for _, name := range m.generatedNames(StructDef) {
+			owners[StructDef.pkgPath][name] = structName
+		}
+		shapes[structName] = m.generatedShapes(StructDef)
+	}
+
+	type generatedDecl struct {
+		structName string
+		filename   string
+		decl       ast.Decl
+	}
+	var decls []generatedDecl
+	declared := map[token.Pos]string{} // 宣言した識別子の位置 -> 構造体名
+	files := map[string]*ast.File{}
+	for _, pkg := range pkgs {
+		names, ok := owners[pkg.PkgPath]
+		if !ok {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			filename := m.fs.Position(file.Pos()).Filename
+			if _, ok := files[filename]; ok {
+				continue
+			}
+			files[filename] = file
+			for _, decl := range file.Decls {
+				name, ident := generatedDeclName(decl)
+				structName, ok := names[name]
+				// 名前が同じでも、手で書き換えた宣言や手で書いた宣言は削除しない
+				if !ok || !shapes[structName][declShape(m.fs, decl)] {
+					continue
+				}
+				decls = append(decls, generatedDecl{structName: structName, filename: filename, decl: decl})
+				declared[ident.Pos()] = structName
+			}
+		}
+	}
+
+	inGenerated := func(pos token.Pos) bool {
+		for _, d := range decls {
+			if d.decl.Pos() <= pos && pos < d.decl.End() {
+				return true
+			}
+		}
+		return false
+	}
+	used := map[string]bool{}
+	for _, pkg := range pkgs {
+		// テストのmainパッケージは往復テストを参照するが、利用とはみなさない
+		if strings.HasSuffix(pkg.PkgPath, ".test") {
+			continue
+		}
+		for ident, obj := range pkg.TypesInfo.Uses {
+			structName, ok := declared[obj.Pos()]
+			if !ok || inGenerated(ident.Pos()) {
+				continue
+			}
+			used[structName] = true
+			slog.Debug("generated code is still used", slog.String("struct", structName), slog.String("at", m.fs.Position(ident.Pos()).String()))
+		}
+	}
+
+	removed := map[string]bool{}
+	modified := map[string]bool{}
+	for _, d := range decls {
+		if used[d.structName] {
+			continue
+		}
+		file := files[d.filename]
+		file.Decls = slices.DeleteFunc(file.Decls, func(decl ast.Decl) bool {
+			return decl == d.decl
+		})
+		// 宣言の中のコメントが残らないようにする
+		start := d.decl.Pos()
+		if doc := declDoc(d.decl); doc != nil {
+			start = doc.Pos()
+		}
+		file.Comments = slices.DeleteFunc(file.Comments, func(c *ast.CommentGroup) bool {
+			return start <= c.Pos() && c.End() <= d.decl.End()
+		})
+		removed[d.structName] = true
+		modified[d.filename] = true
+	}
+
+	for _, filename := range slices.Sorted(maps.Keys(modified)) {
+		file := files[filename]
+		// 生成したコードだけのファイルは削除する。コメントが残る場合は手で書いた内容があるため残す
+		if len(file.Comments) == 0 && !slices.ContainsFunc(file.Decls, func(decl ast.Decl) bool {
+			gen, ok := decl.(*ast.GenDecl)
+			return !ok || gen.Tok != token.IMPORT
+		}) {
+			if err := m.journal.Remove(filename); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := m.journal.RecordFile(filename); err != nil {
+			return nil, err
+		}
+		if err := writeFile(m.fs, file, filename); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, structName := range slices.Sorted(maps.Keys(removed)) {
+		slog.Info("Removed constructor", slog.String("struct", structName))
+	}
+	return slices.Sorted(maps.Keys(removed)), nil
+}
+
+// generatedDeclName は宣言を生成したコードとして照合する名前と、宣言した識別子を返す
+// メソッドはレシーバの型の名前で照合する
+func generatedDeclName(decl ast.Decl) (string, *ast.Ident) {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv == nil || len(d.Recv.List) == 0 {
+			return d.Name.Name, d.Name
+		}
+		recv := d.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		switch r := recv.(type) {
+		case *ast.IndexExpr:
+			recv = r.X
+		case *ast.IndexListExpr:
+			recv = r.X
+		}
+		if ident, ok := recv.(*ast.Ident); ok {
+			return ident.Name, d.Name
+		}
+	case *ast.GenDecl:
+		if d.Tok == token.TYPE && len(d.Specs) == 1 {
+			ts := d.Specs[0].(*ast.TypeSpec)
+			return ts.Name.Name, ts.Name
+		}
+	}
+	return "", nil
+}
+
+// generatedShapes は構造体について migrate struct が生成する宣言を、すべての形式について整形して返す
+func (m *MigrateStruct) generatedShapes(StructDef StructDef) map[string]bool {
+	nakedStructName := StructDef.named.Obj().Name()
+	style := m.style
+	defer func() { m.style = style }()
+
+	shapes := map[string]bool{}
+	for _, m.style = range []ConstructorStyle{StyleParams, StyleOptions, StyleBuilder} {
+		var code string
+		switch m.style {
+		case StyleOptions:
+			code = m.optionsConstructor(nakedStructName, StructDef)
+		case StyleBuilder:
+			code = m.builderConstructor(nakedStructName, StructDef)
+		default:
+			code = m.paramsConstructor(nakedStructName, StructDef)
+		}
+		code += "\n" + m.roundTripTestCode(nakedStructName, StructDef)
+		fs := token.NewFileSet()
+		file, err := parser.ParseFile(fs, "", "package "+StructDef.pkg+"\n"+code, 0)
+		if err != nil {
+			slog.Debug("failed to parse generated code", slog.String("struct", nakedStructName), slog.Any("error", err))
+			continue
+		}
+		for _, decl := range file.Decls {
+			shapes[declShape(fs, decl)] = true
+		}
+	}
+	return shapes
+}
+
+// declShape は宣言をコメントを除いて整形した文字列を返す
+func declShape(fs *token.FileSet, decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		copied := *d
+		copied.Doc = nil
+		decl = &copied
+	case *ast.GenDecl:
+		copied := *d
+		copied.Doc = nil
+		decl = &copied
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fs, decl); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// declDoc は宣言のドキュメントコメントを返す
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+	return nil
+}
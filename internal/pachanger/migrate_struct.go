@@ -2,29 +2,63 @@ package pachanger
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"log/slog"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
 )
 
 // パッケージ情報を取得
 type StructDef struct {
 	pkg       string
+	pkgPath   string
 	filePath  string
 	fields    map[string]string // フィールド名 -> 型
 	fieldList []string          // フィールドの順番を保持
+	named     *types.Named
+	// ジェネリックな構造体の型パラメータの宣言 (例: "[T any]") と参照 (例: "[T]")
+	typeParams string
+	typeArgs   string
+	// フィールドの型が参照するパッケージの import path -> 別名(別名がなければ空)
+	imports map[string]string
+}
+
+// ConstructorStyle は生成するコンストラクタの形式
+type ConstructorStyle string
+
+const (
+	// StyleParams は XxxParams 構造体を受け取るコンストラクタを生成する
+	StyleParams ConstructorStyle = "params"
+	// StyleOptions は WithXxx オプション関数と可変長引数のコンストラクタを生成する
+	StyleOptions ConstructorStyle = "options"
+	// StyleBuilder はメソッドチェーンで値を設定するビルダーを生成する
+	StyleBuilder ConstructorStyle = "builder"
+)
+
+// ParseConstructorStyle は --style フラグの値を解析する
+func ParseConstructorStyle(s string) (ConstructorStyle, error) {
+	switch style := ConstructorStyle(s); style {
+	case StyleParams, StyleOptions, StyleBuilder:
+		return style, nil
+	}
+	return "", fmt.Errorf("unknown style %q: must be one of params, options, builder", s)
 }
 
 type MigrateStruct struct {
@@ -32,6 +66,19 @@ type MigrateStruct struct {
 	fs        *token.FileSet
 	targetpkg string
 	suffix    string
+	style     ConstructorStyle
+	// コンストラクタを本番コードではなく export_test.go に生成する
+	exportTest bool
+	// コンストラクタの引数が構造体の各フィールドに渡ることを確かめるテストを生成する
+	roundTripTest bool
+	journal       *Journal
+	pkgs          []*packages.Package
+	// targetpkg がパターンの場合に一致したパッケージの import path
+	targetPaths map[string]bool
+	// 現在のファイルで書き換えたリテラルの数
+	rewrites int
+	// export_test.go のコンストラクタを参照できないため書き換えなかったリテラル
+	unreachable []SkippedReference
 }
 
 func NewMigrateStruct(workDir, targetpkg, suffix string) (*MigrateStruct, error) {
@@ -44,72 +91,497 @@ func NewMigrateStruct(workDir, targetpkg, suffix string) (*MigrateStruct, error)
 		workDir:   absWorkDir,
 		targetpkg: targetpkg,
 		suffix:    suffix,
+		style:     StyleParams,
 		fs:        token.NewFileSet(),
 	}, nil
 }
 
+// SetStyle は生成するコンストラクタの形式を変更する
+func (m *MigrateStruct) SetStyle(style ConstructorStyle) {
+	m.style = style
+}
+
+// SetExportTest は生成したコンストラクタを構造体と同じパッケージの
+// export_test.go に書き出すようにする。本番のバイナリにはテスト用のAPIが含まれなくなる
+func (m *MigrateStruct) SetExportTest(exportTest bool) {
+	m.exportTest = exportTest
+}
+
+// SetRoundTripTest はコンストラクタごとに、すべての引数が対応するフィールドに
+// 設定されることを確かめるテストを生成するようにする
+func (m *MigrateStruct) SetRoundTripTest(roundTripTest bool) {
+	m.roundTripTest = roundTripTest
+}
+
+// constructorFile はコンストラクタを生成するファイルを返す
+func (m *MigrateStruct) constructorFile(StructDef StructDef) string {
+	if m.exportTest {
+		return filepath.Join(filepath.Dir(StructDef.filePath), "export_test.go")
+	}
+	return StructDef.filePath
+}
+
+// reachable は testFile から StructDef のコンストラクタを参照できるかを返す
+// export_test.go の宣言は構造体と同じディレクトリのテストからしか参照できない
+func (m *MigrateStruct) reachable(testFile string, StructDef StructDef) bool {
+	return !m.exportTest || filepath.Dir(filepath.Clean(testFile)) == filepath.Dir(StructDef.filePath)
+}
+
+// SetJournal は書き換えるファイルの変更前の内容を journal に記録するようにする
+func (m *MigrateStruct) SetJournal(journal *Journal) {
+	m.journal = journal
+}
+
+// MigrateSummary は migrate struct の実行結果
+type MigrateSummary struct {
+	// 書き換えたテストファイル
+	Files []string
+	// コンストラクタを生成した構造体
+	Constructors []string
+	// 書き換えた構造体リテラルの数
+	Literals int
+	// --export-test で、構造体と別のディレクトリにあるため書き換えなかったリテラル
+	Unreachable []SkippedReference
+}
+
 func (m *MigrateStruct) Migrate(testFile string) error {
 	if !filepath.IsAbs(testFile) {
 		testFile = path.Join(m.workDir, testFile)
 	}
+	_, err := m.MigrateFiles([]string{testFile})
+	return err
+}
 
-	StructDefs := m.FindStructDefinitions()
-	usedStructs, err := m.FindUsedStructs(testFile)
+// MigrateAll はモジュール内のすべてのテストファイルを対象に書き換える
+func (m *MigrateStruct) MigrateAll() (*MigrateSummary, error) {
+	// 前回の実行で書き換えたファイルを反映させるため、毎回読み込み直す
+	m.pkgs = nil
+	testFiles, err := m.testFiles()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return m.migrateFiles(testFiles)
+}
+
+// testFiles はモジュール内のすべてのテストファイルを返す
+func (m *MigrateStruct) testFiles() ([]string, error) {
+	pkgs, err := m.loadedPackages()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var testFiles []string
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			filename := m.fs.Position(file.Pos()).Filename
+			if !strings.HasSuffix(filename, "_test.go") || seen[filename] {
+				continue
+			}
+			seen[filename] = true
+			testFiles = append(testFiles, filename)
+		}
+	}
+	slices.Sort(testFiles)
+	return testFiles, nil
+}
+
+// MigrateFiles は指定したテストファイルの構造体リテラルを書き換える
+// 複数のファイルで使われている構造体のコンストラクタは一度だけ生成する
+func (m *MigrateStruct) MigrateFiles(testFiles []string) (*MigrateSummary, error) {
+	m.pkgs = nil
+	return m.migrateFiles(testFiles)
+}
+
+func (m *MigrateStruct) migrateFiles(testFiles []string) (*MigrateSummary, error) {
+	if err := m.resolveTargets(); err != nil {
+		return nil, err
+	}
+	StructDefs, err := m.FindStructDefinitions()
+	if err != nil {
+		return nil, err
+	}
+
+	// 全ファイルで使われている構造体をまとめる
+	usedStructs := map[string][]string{}
+	for _, testFile := range testFiles {
+		used, err := m.FindUsedStructs(testFile)
+		if err != nil {
+			return nil, err
+		}
+		for structName, fields := range used {
+			if StructDef, ok := StructDefs[structName]; ok && !m.reachable(testFile, StructDef) {
+				continue
+			}
+			usedStructs[structName] = slices.Compact(append(usedStructs[structName], fields...))
+		}
 	}
 
+	summary := &MigrateSummary{}
+	var generated []string
 	// コンストラクタとパラメータ構造体がない場合は作成
-	for structName, StructDef := range StructDefs {
-		// 同一パッケージかどうかチェック
-		if StructDef.pkg != m.targetpkg {
+	for _, structName := range slices.Sorted(maps.Keys(StructDefs)) {
+		StructDef := StructDefs[structName]
+		// 対象パッケージかどうかチェック
+		if !m.isTarget(StructDef) {
 			continue
 		}
 		_, ok := usedStructs[structName]
 		if ok {
-			if !m.HasConstructor(StructDef.filePath, structName) {
-				slog.Info("Adding constructor", slog.String("struct", structName))
-				str, err := m.AddConstructorWithParamsStructRefactored(StructDef.filePath, structName, StructDefs)
+			filePath := m.constructorFile(StructDef)
+			if !m.HasConstructor(filePath, structName) {
+				slog.Info("Adding constructor", slog.String("struct", structName), slog.String("file", filePath))
+				str, err := m.AddConstructor(filePath, structName, StructDefs)
 				if err != nil {
-					return err
+					return nil, err
+				}
+				if str == "" {
+					continue
 				}
 
-				if err := os.WriteFile(StructDef.filePath, []byte(str), 0644); err != nil {
-					return err
+				if err := m.journal.RecordFile(filePath); err != nil {
+					return nil, err
+				}
+				if err := os.WriteFile(filePath, []byte(str), 0644); err != nil {
+					return nil, err
 				}
+				summary.Constructors = append(summary.Constructors, structName)
+				generated = append(generated, filePath)
 
+				if m.roundTripTest {
+					testPath, err := m.addRoundTripTest(structName, StructDef)
+					if err != nil {
+						return nil, err
+					}
+					if testPath != "" {
+						generated = append(generated, testPath)
+					}
+				}
 			}
 		}
 	}
 
-	// テストファイルを書き換える
-	n, err := m.RewriteTestFileRefactored(testFile, StructDefs, usedStructs)
+	restore, err := chdirGoModDir(m.workDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if n != nil {
-		restore, err := chdirGoModDir(m.workDir)
+	defer restore()
+
+	// テストファイルを書き換える
+	m.unreachable = nil
+	for _, testFile := range testFiles {
+		m.rewrites = 0
+		n, err := m.RewriteTestFileRefactored(testFile, StructDefs, usedStructs)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if n == nil {
+			continue
+		}
+		if err := m.journal.RecordFile(testFile); err != nil {
+			return nil, err
 		}
-		defer restore()
 		if err := writeFile(m.fs, n, testFile); err != nil {
-			return err
+			return nil, err
 		}
+		summary.Files = append(summary.Files, testFile)
+		summary.Literals += m.rewrites
+	}
+	summary.Unreachable = m.unreachable
+
+	// 書き換えたテストも型チェックし、コンストラクタへの置き換えで壊れていないかを確かめる
+	if err := m.verify(append(generated, summary.Files...)); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// verify は生成・書き換えしたコードを型チェックし、存在しないフィールドの参照などがあればエラーを返す
+func (m *MigrateStruct) verify(files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	m.pkgs = nil
+	pkgs, err := m.loadedPackages()
+	if err != nil {
+		return err
+	}
+	targets := map[string]bool{}
+	for _, f := range files {
+		targets[f] = true
+	}
+	seen := map[string]bool{}
+	var problems []string
+	for _, pkg := range pkgs {
+		for _, e := range pkg.Errors {
+			filename, _, _ := strings.Cut(e.Pos, ":")
+			if !targets[filename] || seen[e.Error()] {
+				continue
+			}
+			seen[e.Error()] = true
+			problems = append(problems, e.Error())
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("generated code does not compile:\n%s", strings.Join(problems, "\n"))
 	}
 	return nil
 }
 
-// findUsedStructs：テストファイルから使用している構造体情報を取得
-func (m *MigrateStruct) FindUsedStructs(testFile string) (map[string][]string, error) {
-	src, err := os.ReadFile(testFile)
+// addRoundTripTest は構造体と同じパッケージにコンストラクタの往復テストを追加し、そのファイルを返す
+// ジェネリックな構造体は型引数を決められないため生成しない
+func (m *MigrateStruct) addRoundTripTest(structName string, StructDef StructDef) (string, error) {
+	if StructDef.typeParams != "" {
+		slog.Debug("skip round-trip test for generic struct", slog.String("struct", structName))
+		return "", nil
+	}
+	nakedStructName := structName[strings.LastIndex(structName, ".")+1:]
+	constructorName, _ := m.constructorNames(nakedStructName)
+	testFunc := "func Test" + constructorName + "RoundTrip("
+
+	filePath := strings.TrimSuffix(StructDef.filePath, ".go") + "_roundtrip_test.go"
+	src, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		src, err = []byte("package "+StructDef.pkg+"\n"), nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to read test file: %v", err)
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	if strings.Contains(string(src), testFunc) {
+		return "", nil
 	}
 
-	node, err := parser.ParseFile(m.fs, testFile, src, parser.AllErrors)
+	imports := maps.Clone(StructDef.imports)
+	for _, importPath := range []string{"math/rand", "reflect", "testing", "testing/quick"} {
+		imports[importPath] = ""
+	}
+	code, err := addImports(filePath, string(src)+"\n"+m.roundTripTestCode(nakedStructName, StructDef), imports)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse test file: %v", err)
+		return "", err
+	}
+	if err := m.journal.RecordFile(filePath); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filePath, []byte(code), 0644); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// quickable は testing/quick の Value で値を生成できる型かを判定する
+// 非公開フィールドを持つ構造体を含む型は Value が panic するため対象外とする
+func quickable(t types.Type, seen map[types.Type]bool) bool {
+	if seen[t] {
+		return true
+	}
+	seen[t] = true
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u.Kind() != types.UnsafePointer
+	case *types.Pointer:
+		return quickable(u.Elem(), seen)
+	case *types.Slice:
+		return quickable(u.Elem(), seen)
+	case *types.Array:
+		return quickable(u.Elem(), seen)
+	case *types.Map:
+		return quickable(u.Key(), seen) && quickable(u.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if !u.Field(i).Exported() || !quickable(u.Field(i).Type(), seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// roundTripTestCode はランダムな値をコンストラクタに渡し、各フィールドに同じ値が
+// 設定されていることを確かめるテストを生成する
+func (m *MigrateStruct) roundTripTestCode(nakedStructName string, StructDef StructDef) string {
+	constructorName, typeName := m.constructorNames(nakedStructName)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "func Test%sRoundTrip(t *testing.T) {\n", constructorName)
+	b.WriteString("\trnd := rand.New(rand.NewSource(1))\n")
+	st := StructDef.named.Underlying().(*types.Struct)
+	for i, fieldName := range StructDef.fieldList {
+		fmt.Fprintf(&b, "\tvar v%d %s\n", i, StructDef.fields[fieldName])
+		// testing/quick で値を作れない型はゼロ値のまま比較する
+		if !quickable(st.Field(i).Type(), map[types.Type]bool{}) {
+			continue
+		}
+		fmt.Fprintf(&b, "\tif v, ok := quick.Value(reflect.TypeOf(&v%d).Elem(), rnd); ok {\n", i)
+		fmt.Fprintf(&b, "\t\treflect.ValueOf(&v%d).Elem().Set(v)\n", i)
+		b.WriteString("\t}\n")
+	}
+
+	switch m.style {
+	case StyleOptions:
+		fmt.Fprintf(&b, "\tgot := %s(\n", constructorName)
+		for i, fieldName := range StructDef.fieldList {
+			fmt.Fprintf(&b, "\t\t%s(v%d),\n", m.optionFuncName(nakedStructName, fieldName), i)
+		}
+		b.WriteString("\t)\n")
+	case StyleBuilder:
+		fmt.Fprintf(&b, "\tgot := %s()", constructorName)
+		for i, fieldName := range StructDef.fieldList {
+			fmt.Fprintf(&b, ".\n\t\t%s(v%d)", exportedFieldName(fieldName), i)
+		}
+		b.WriteString(".\n\t\tBuild()\n")
+	default:
+		fmt.Fprintf(&b, "\tgot := %s(&%s{\n", constructorName, typeName)
+		for i, fieldName := range StructDef.fieldList {
+			fmt.Fprintf(&b, "\t\t%s: v%d,\n", exportedFieldName(fieldName), i)
+		}
+		b.WriteString("\t})\n")
+	}
+
+	for i, fieldName := range StructDef.fieldList {
+		fmt.Fprintf(&b, "\tif !reflect.DeepEqual(got.%s, v%d) {\n", fieldName, i)
+		fmt.Fprintf(&b, "\t\tt.Error(\"%s is not set by %s\")\n", fieldName, constructorName)
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// isPackagePattern は --pkg がパッケージ名ではなく ./internal/... のようなパターンかを判定する
+func isPackagePattern(s string) bool {
+	return strings.HasPrefix(s, ".") || strings.Contains(s, "/")
+}
+
+// resolveTargets は対象がパターンで指定された場合に一致するパッケージを求める
+func (m *MigrateStruct) resolveTargets() error {
+	if !isPackagePattern(m.targetpkg) || m.targetPaths != nil {
+		return nil
+	}
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName, Dir: m.workDir}, m.targetpkg)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", m.targetpkg, err)
+	}
+	m.targetPaths = map[string]bool{}
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			continue
+		}
+		m.targetPaths[pkg.PkgPath] = true
+	}
+	if len(m.targetPaths) == 0 {
+		return fmt.Errorf("no packages matched %s", m.targetpkg)
+	}
+	return nil
+}
+
+// isTarget は構造体が書き換え対象のパッケージに属し、非公開フィールドを持つかを判定する
+// 公開フィールドのみの構造体はパッケージ外からもリテラルで生成できるため対象外とする
+func (m *MigrateStruct) isTarget(StructDef StructDef) bool {
+	if m.targetPaths != nil {
+		if !m.targetPaths[StructDef.pkgPath] {
+			return false
+		}
+	} else if StructDef.pkg != m.targetpkg {
+		return false
+	}
+	for _, fieldName := range StructDef.fieldList {
+		if !token.IsExported(fieldName) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadedPackages はモジュール内のパッケージを型情報付きで読み込む
+func (m *MigrateStruct) loadedPackages() ([]*packages.Package, error) {
+	if m.pkgs != nil {
+		return m.pkgs, nil
+	}
+	pkgs, err := loadPackages(m.fs, m.workDir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	m.pkgs = pkgs
+	return pkgs, nil
+}
+
+// findFile は読み込んだパッケージから filename の AST とパッケージを探す
+func (m *MigrateStruct) findFile(filename string) (*ast.File, *packages.Package, error) {
+	pkgs, err := m.loadedPackages()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			if m.fs.Position(file.Pos()).Filename == filename {
+				return file, pkg, nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("file %s not found in packages", filename)
+}
+
+// typeKey は型を import path 付きの名前で識別する
+// 同じ名前のパッケージが複数あっても衝突しない
+func typeKey(obj *types.TypeName) string {
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// structKeyOf は `pkg.XXX{...}` のリテラルが表す構造体のキーを返す
+func structKeyOf(info *types.Info, cl *ast.CompositeLit) string {
+	tv, ok := info.Types[cl]
+	if !ok || tv.Type == nil {
+		return ""
+	}
+	named := namedOf(tv.Type)
+	if named == nil || named.Obj().Pkg() == nil {
+		return ""
+	}
+	return typeKey(named.Origin().Obj())
+}
+
+// fileQualifier はファイルのimport文に合わせてパッケージ名を修飾する
+func fileQualifier(file *ast.File, pkg *packages.Package) types.Qualifier {
+	return func(p *types.Package) string {
+		if name, ok := importName(file, pkg, p.Path()); ok {
+			return name
+		}
+		return p.Name()
+	}
+}
+
+// importName は file の中で pkgPath のパッケージを参照するときの名前を返す
+// 同じパッケージやドットインポートの場合は空文字を返し、import していない場合は false を返す
+func importName(file *ast.File, pkg *packages.Package, pkgPath string) (string, bool) {
+	if pkgPath == pkg.PkgPath {
+		return "", true
+	}
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || importPath != pkgPath {
+			continue
+		}
+		if imp.Name != nil {
+			switch imp.Name.Name {
+			case ".":
+				return "", true
+			case "_":
+				return "", false
+			}
+			return imp.Name.Name, true
+		}
+		if p, ok := pkg.Imports[importPath]; ok {
+			return p.Name, true
+		}
+	}
+	return "", false
+}
+
+// findUsedStructs：テストファイルから使用している構造体情報を取得
+func (m *MigrateStruct) FindUsedStructs(testFile string) (map[string][]string, error) {
+	node, pkg, err := m.findFile(testFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find test file: %v", err)
 	}
 
 	usedStructs := make(map[string][]string)
@@ -129,17 +601,10 @@ func (m *MigrateStruct) FindUsedStructs(testFile string) (map[string][]string, e
 			return true
 		}
 
-		se, ok := cl.Type.(*ast.SelectorExpr)
-		if !ok {
+		structName := structKeyOf(pkg.TypesInfo, cl)
+		if structName == "" {
 			return true
 		}
-
-		pkgIdent, ok := se.X.(*ast.Ident)
-		if !ok {
-			return true
-		}
-
-		structName := fmt.Sprintf("%s.%s", pkgIdent.Name, se.Sel.Name)
 		var fields []string
 
 		for _, el := range cl.Elts {
@@ -161,66 +626,90 @@ func (m *MigrateStruct) FindUsedStructs(testFile string) (map[string][]string, e
 	return usedStructs, nil
 }
 
-// findStructDefinitions：パッケージ内の構造体定義をスキャンして情報化
-func (m *MigrateStruct) FindStructDefinitions() map[string]StructDef {
+// findStructDefinitions：パッケージ内の構造体定義を型情報から収集
+func (m *MigrateStruct) FindStructDefinitions() (map[string]StructDef, error) {
+	pkgs, err := m.loadedPackages()
+	if err != nil {
+		return nil, err
+	}
 	StructDefs := make(map[string]StructDef)
 
-	_ = filepath.Walk(m.workDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
-			return nil
-		}
-
-		src, err := os.ReadFile(path)
-		if err != nil {
-			return nil
-		}
-
-		node, err := parser.ParseFile(m.fs, path, src, parser.AllErrors)
-		if err != nil {
-			return nil
+	for _, pkg := range pkgs {
+		if pkg.Types == nil || strings.HasSuffix(pkg.Name, "_test") {
+			continue
 		}
+		for _, file := range pkg.Syntax {
+			filePath := m.fs.Position(file.Pos()).Filename
+			if strings.HasSuffix(filePath, "_test.go") {
+				continue
+			}
+			fileQualifier := fileQualifier(file, pkg)
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					obj, ok := pkg.TypesInfo.Defs[ts.Name].(*types.TypeName)
+					if !ok || obj.IsAlias() {
+						continue
+					}
+					named, ok := obj.Type().(*types.Named)
+					if !ok {
+						continue
+					}
+					st, ok := named.Underlying().(*types.Struct)
+					if !ok {
+						continue
+					}
+					structName := typeKey(obj)
+					if _, ok := StructDefs[structName]; ok {
+						continue
+					}
 
-		ast.Inspect(node, func(n ast.Node) bool {
-			if ts, ok := n.(*ast.TypeSpec); ok {
-				structName := fmt.Sprintf("%s.%s", node.Name.Name, ts.Name.Name)
-				switch t := ts.Type.(type) {
-				case *ast.StructType:
 					StructDef := StructDef{
-						filePath:  path,
+						filePath:  filePath,
 						fields:    make(map[string]string),
 						fieldList: []string{},
-						pkg:       node.Name.Name,
+						pkg:       pkg.Name,
+						pkgPath:   pkg.PkgPath,
+						named:     named,
+						imports:   map[string]string{},
 					}
-					for _, field := range t.Fields.List {
-						typeStr := exprToString(field.Type)
-						unshifted := strings.TrimPrefix(typeStr, "*")
-
-						if isUpperFirst(unshifted) && node.Name.Name == m.targetpkg {
-							if strings.HasPrefix(typeStr, "*") {
-								typeStr = fmt.Sprintf("*%s.%s", node.Name.Name, unshifted)
-							} else {
-								typeStr = fmt.Sprintf("%s.%s", node.Name.Name, unshifted)
+					// 別ファイルに生成する場合に必要な import を記録する
+					qualifier := func(p *types.Package) string {
+						name := fileQualifier(p)
+						if name != "" {
+							StructDef.imports[p.Path()] = ""
+							if name != p.Name() {
+								StructDef.imports[p.Path()] = name
 							}
 						}
-
-						if len(field.Names) == 0 {
-							StructDef.fieldList = append(StructDef.fieldList, typeStr)
-						} else {
-							for _, name := range field.Names {
-								StructDef.fields[name.Name] = typeStr
-								StructDef.fieldList = append(StructDef.fieldList, name.Name)
-							}
+						return name
+					}
+					if tparams := named.TypeParams(); tparams.Len() > 0 {
+						var params, args []string
+						for i := 0; i < tparams.Len(); i++ {
+							tp := tparams.At(i)
+							params = append(params, tp.Obj().Name()+" "+types.TypeString(tp.Constraint(), qualifier))
+							args = append(args, tp.Obj().Name())
 						}
+						StructDef.typeParams = "[" + strings.Join(params, ", ") + "]"
+						StructDef.typeArgs = "[" + strings.Join(args, ", ") + "]"
+					}
+					for i := 0; i < st.NumFields(); i++ {
+						field := st.Field(i)
+						StructDef.fields[field.Name()] = types.TypeString(field.Type(), qualifier)
+						StructDef.fieldList = append(StructDef.fieldList, field.Name())
 					}
 					StructDefs[structName] = StructDef
 				}
 			}
-			return true
-		})
-		return nil
-	})
+		}
+	}
 
-	return StructDefs
+	return StructDefs, nil
 }
 
 // hasConstructor：構造体にコンストラクタがあるか確認
@@ -236,8 +725,7 @@ func (m *MigrateStruct) HasConstructor(filePath, structName string) bool {
 	}
 
 	nakedStructName := structName[strings.LastIndex(structName, ".")+1:]
-	funcName := "New" + nakedStructName + m.suffix
-	paramsStructName := nakedStructName + "Params" + m.suffix
+	funcName, typeName := m.constructorNames(nakedStructName)
 
 	existsConstructor := false
 	existsParams := false
@@ -247,7 +735,7 @@ func (m *MigrateStruct) HasConstructor(filePath, structName string) bool {
 			existsConstructor = true
 		}
 		if ts, ok := n.(*ast.TypeSpec); ok {
-			if ts.Name.Name == paramsStructName {
+			if ts.Name.Name == typeName {
 				existsParams = true
 			}
 		}
@@ -257,7 +745,73 @@ func (m *MigrateStruct) HasConstructor(filePath, structName string) bool {
 	return existsConstructor && existsParams
 }
 
-func (m *MigrateStruct) AddConstructorWithParamsStructRefactored(
+// constructorNames は形式ごとに生成するコンストラクタ関数と補助の型の名前を返す
+func (m *MigrateStruct) constructorNames(nakedStructName string) (funcName, typeName string) {
+	return m.constructorNamesFor(m.style, nakedStructName)
+}
+
+func (m *MigrateStruct) constructorNamesFor(style ConstructorStyle, nakedStructName string) (funcName, typeName string) {
+	// 非公開の構造体でも外部テストパッケージから呼べる名前にする
+	nakedStructName = capitalizeFirst(nakedStructName)
+	switch style {
+	case StyleOptions:
+		return "New" + nakedStructName + m.suffix, nakedStructName + "Option" + m.suffix
+	case StyleBuilder:
+		return "New" + nakedStructName + "Builder" + m.suffix, nakedStructName + "Builder" + m.suffix
+	default:
+		return "New" + nakedStructName + m.suffix, nakedStructName + "Params" + m.suffix
+	}
+}
+
+// optionFuncName は options 形式でフィールドを設定する関数の名前を返す
+func (m *MigrateStruct) optionFuncName(nakedStructName, fieldName string) string {
+	return "With" + capitalizeFirst(nakedStructName) + exportedFieldName(fieldName) + m.suffix
+}
+
+// commonInitialisms は公開名で全て大文字にする略語
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true,
+	"EOF": true, "GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"IP": true, "JSON": true, "QPS": true, "RAM": true, "RPC": true, "SLA": true,
+	"SMTP": true, "SQL": true, "SSH": true, "TCP": true, "TLS": true, "TTL": true,
+	"UDP": true, "UI": true, "UID": true, "UUID": true, "URI": true, "URL": true,
+	"UTF8": true, "VM": true, "XML": true, "XMPP": true, "XSRF": true, "XSS": true,
+}
+
+// exportedFieldName はフィールド名を公開名にする
+// 単語の区切りを保ったまま先頭を大文字にし、id や url などの略語は全て大文字にする (userId -> UserID)
+func exportedFieldName(name string) string {
+	var b strings.Builder
+	for _, word := range splitCamelCase(name) {
+		if upper := strings.ToUpper(word); commonInitialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(word)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(word[size:])
+	}
+	return b.String()
+}
+
+// splitCamelCase は小文字や数字の直後の大文字で名前を単語に分ける
+func splitCamelCase(name string) []string {
+	var words []string
+	start := 0
+	prev := rune(0)
+	for i, r := range name {
+		if i > start && unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) {
+			words = append(words, name[start:i])
+			start = i
+		}
+		prev = r
+	}
+	return append(words, name[start:])
+}
+
+// AddConstructor は構造体のテスト用コンストラクタを形式に合わせて生成し、
+// ファイルの末尾に追加した内容を返す
+func (m *MigrateStruct) AddConstructor(
 	filePath, structName string,
 	StructDefs map[string]StructDef,
 ) (string, error) {
@@ -272,83 +826,192 @@ func (m *MigrateStruct) AddConstructorWithParamsStructRefactored(
 
 	// ファイルの内容を読み取る
 	src, err := os.ReadFile(filePath)
+	if m.exportTest && errors.Is(err, os.ErrNotExist) {
+		src, err = []byte("package "+StructDef.pkg+"\n"), nil
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
 
-	// 構造体名とパラメータ構造体の名前を取得
+	// 構造体名と生成する関数・型の名前を取得
 	nakedStructName := structName[strings.LastIndex(structName, ".")+1:]
-	paramsStructName := nakedStructName + "Params" + m.suffix
-	constructorName := "New" + nakedStructName + m.suffix
+	constructorName, typeName := m.constructorNames(nakedStructName)
 
-	if strings.Contains(string(src), "type "+paramsStructName) &&
+	// 公開名にしたときに同じ名前になるフィールドがあると正しく対応付けられない
+	exportedNames := map[string]string{}
+	for _, fieldName := range StructDef.fieldList {
+		exportedName := exportedFieldName(fieldName)
+		if other, ok := exportedNames[exportedName]; ok {
+			return "", fmt.Errorf("fields %s and %s of %s both map to %s", other, fieldName, structName, exportedName)
+		}
+		exportedNames[exportedName] = fieldName
+	}
+
+	if strings.Contains(string(src), "type "+typeName) &&
 		strings.Contains(string(src), "func "+constructorName) {
-		slog.Debug("constructor with params struct already exists", slog.String("struct", structName))
+		slog.Debug("constructor already exists", slog.String("struct", structName))
 		return "", nil
 	}
 
+	var code string
+	switch m.style {
+	case StyleOptions:
+		code = m.optionsConstructor(nakedStructName, StructDef)
+	case StyleBuilder:
+		code = m.builderConstructor(nakedStructName, StructDef)
+	default:
+		code = m.paramsConstructor(nakedStructName, StructDef)
+	}
+
+	// バッファに追加して返す
+	var buf strings.Builder
+	buf.Write(src)
+	buf.WriteString("\n\n")
+	buf.WriteString(code)
+
+	if m.exportTest {
+		return addImports(filePath, buf.String(), StructDef.imports)
+	}
+	return buf.String(), nil
+}
+
+// addImports は src に imports のパッケージの import 文を追加して整形する
+func addImports(filePath, src string, imports map[string]string) (string, error) {
+	fs := token.NewFileSet()
+	node, err := parser.ParseFile(fs, filePath, src, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse generated code: %w", err)
+	}
+	for _, importPath := range slices.Sorted(maps.Keys(imports)) {
+		astutil.AddNamedImport(fs, node, imports[importPath], importPath)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fs, node); err != nil {
+		return "", fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// paramsConstructor は XxxParams 構造体を受け取るコンストラクタを生成する
+func (m *MigrateStruct) paramsConstructor(nakedStructName string, StructDef StructDef) string {
+	constructorName, paramsStructName := m.constructorNames(nakedStructName)
+	typeParams, typeArgs := StructDef.typeParams, StructDef.typeArgs
+
 	var fieldsBuilder strings.Builder
-	fieldsBuilder.WriteString("type " + paramsStructName + " struct {\n")
+	fmt.Fprintf(&fieldsBuilder, "type %s%s struct {\n", paramsStructName, typeParams)
 
 	for _, fieldName := range StructDef.fieldList {
-		cleanFieldName := strings.TrimPrefix(fieldName, m.targetpkg+".")
-		// ポインタ型の処理
-		if strings.HasPrefix(fieldName, "*") {
-			cleanFieldName = "*" + cleanFieldName
-		}
-
-		exportedName := cases.Title(language.English).String(cleanFieldName)
-		fmt.Fprintf(&fieldsBuilder, "    %s %s\n", exportedName, StructDef.fields[fieldName])
+		fmt.Fprintf(&fieldsBuilder, "    %s %s\n", exportedFieldName(fieldName), StructDef.fields[fieldName])
 	}
 
 	fieldsBuilder.WriteString("}\n\n")
 
 	var constructorBuilder strings.Builder
-	fmt.Fprintf(&constructorBuilder, "func %s(params *%s) *%s {\n", constructorName, paramsStructName, nakedStructName)
-	fmt.Fprintf(&constructorBuilder, "    return &%s{\n", nakedStructName)
+	fmt.Fprintf(&constructorBuilder, "func %s%s(params *%s%s) *%s%s {\n", constructorName, typeParams, paramsStructName, typeArgs, nakedStructName, typeArgs)
+	fmt.Fprintf(&constructorBuilder, "    return &%s%s{\n", nakedStructName, typeArgs)
 
 	for _, fieldName := range StructDef.fieldList {
-		exportedName := cases.Title(language.English).String(fieldName)
-		fmt.Fprintf(&constructorBuilder, "        %s: params.%s,\n", exportedName, exportedName)
+		fmt.Fprintf(&constructorBuilder, "        %s: params.%s,\n", fieldName, exportedFieldName(fieldName))
 	}
 	constructorBuilder.WriteString("    }\n")
 	constructorBuilder.WriteString("}\n")
 
-	// 3) バッファに追加して返す
-	var buf strings.Builder
-	buf.Write(src)
-	buf.WriteString("\n\n")
-	buf.WriteString(fieldsBuilder.String())
-	buf.WriteString(constructorBuilder.String())
+	return fieldsBuilder.String() + constructorBuilder.String()
+}
 
-	return buf.String(), nil
+// optionsConstructor は WithXxx オプション関数と可変長引数のコンストラクタを生成する
+func (m *MigrateStruct) optionsConstructor(nakedStructName string, StructDef StructDef) string {
+	constructorName, optionName := m.constructorNames(nakedStructName)
+	typeParams, typeArgs := StructDef.typeParams, StructDef.typeArgs
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %s%s func(*%s%s)\n", optionName, typeParams, nakedStructName, typeArgs)
+	for _, fieldName := range StructDef.fieldList {
+		fmt.Fprintf(&b, "\nfunc %s%s(v %s) %s%s {\n", m.optionFuncName(nakedStructName, fieldName), typeParams, StructDef.fields[fieldName], optionName, typeArgs)
+		fmt.Fprintf(&b, "    return func(s *%s%s) {\n", nakedStructName, typeArgs)
+		fmt.Fprintf(&b, "        s.%s = v\n", fieldName)
+		b.WriteString("    }\n")
+		b.WriteString("}\n")
+	}
+
+	fmt.Fprintf(&b, "\nfunc %s%s(opts ...%s%s) *%s%s {\n", constructorName, typeParams, optionName, typeArgs, nakedStructName, typeArgs)
+	fmt.Fprintf(&b, "    s := &%s%s{}\n", nakedStructName, typeArgs)
+	b.WriteString("    for _, opt := range opts {\n")
+	b.WriteString("        opt(s)\n")
+	b.WriteString("    }\n")
+	b.WriteString("    return s\n")
+	b.WriteString("}\n")
+	return b.String()
 }
 
-// RewriteTestFileRefactored：テストファイルの修正（バッファを使って書き込み）
-func (m *MigrateStruct) RewriteTestFileRefactored(testFile string, StructDefs map[string]StructDef, usedStructs map[string][]string) (*ast.File, error) {
-	src, err := os.ReadFile(testFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read test file: %v", err)
+// builderConstructor はフィールドごとのセッターと Build を持つビルダーを生成する
+func (m *MigrateStruct) builderConstructor(nakedStructName string, StructDef StructDef) string {
+	constructorName, builderName := m.constructorNames(nakedStructName)
+	typeParams, typeArgs := StructDef.typeParams, StructDef.typeArgs
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %s%s struct {\n", builderName, typeParams)
+	fmt.Fprintf(&b, "    v *%s%s\n", nakedStructName, typeArgs)
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(&b, "func %s%s() *%s%s {\n", constructorName, typeParams, builderName, typeArgs)
+	fmt.Fprintf(&b, "    return &%s%s{v: &%s%s{}}\n", builderName, typeArgs, nakedStructName, typeArgs)
+	b.WriteString("}\n")
+
+	for _, fieldName := range StructDef.fieldList {
+		fmt.Fprintf(&b, "\nfunc (b *%s%s) %s(v %s) *%s%s {\n", builderName, typeArgs, exportedFieldName(fieldName), StructDef.fields[fieldName], builderName, typeArgs)
+		fmt.Fprintf(&b, "    b.v.%s = v\n", fieldName)
+		b.WriteString("    return b\n")
+		b.WriteString("}\n")
 	}
 
-	// AST（抽象構文木）を生成
-	node, err := parser.ParseFile(m.fs, testFile, src, parser.AllErrors|parser.ParseComments)
+	fmt.Fprintf(&b, "\nfunc (b *%s%s) Build() *%s%s {\n", builderName, typeArgs, nakedStructName, typeArgs)
+	b.WriteString("    return b.v\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// RewriteTestFileRefactored：テストファイルの修正（バッファを使って書き込み）
+// 内側のリテラルから順に書き換えるため、入れ子になったリテラルも対象になる
+func (m *MigrateStruct) RewriteTestFileRefactored(testFile string, StructDefs map[string]StructDef, usedStructs map[string][]string) (*ast.File, error) {
+	node, pkg, err := m.findFile(testFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse test file: %v", err)
+		return nil, fmt.Errorf("failed to find test file: %v", err)
 	}
 
 	var modified bool
 
-	// ASTを巡回して修正を加える
-	ast.Inspect(node, func(n ast.Node) bool {
-		// 関数リテラルを再帰的にチェック
-		if funcLit, ok := n.(*ast.FuncLit); ok {
-			ast.Inspect(funcLit.Body, func(n ast.Node) bool {
-				modified = m.RewriteHandlerStructs(n, StructDefs, usedStructs) || modified
+	astutil.Apply(node, nil, func(c *astutil.Cursor) bool {
+		var cl *ast.CompositeLit
+		addressed := false
+		switch n := c.Node().(type) {
+		case *ast.UnaryExpr:
+			lit, ok := n.X.(*ast.CompositeLit)
+			if !ok || n.Op != token.AND {
+				return true
+			}
+			cl, addressed = lit, true
+		case *ast.CompositeLit:
+			// `&pkg.XXX{...}` は親の UnaryExpr でまとめて書き換える
+			if u, ok := c.Parent().(*ast.UnaryExpr); ok && u.Op == token.AND {
 				return true
-			})
+			}
+			cl = n
+		default:
+			return true
+		}
+
+		call := m.processCompositeLit(cl, node, pkg, StructDefs)
+		if call == nil {
+			return true
+		}
+		// コンストラクタはポインタを返すため、値が必要な箇所では間接参照する
+		if !addressed && !isPointerLit(pkg.TypesInfo, cl) && !keepsPointer(c) {
+			call = &ast.StarExpr{X: call}
 		}
-		modified = m.RewriteHandlerStructs(n, StructDefs, usedStructs) || modified
+		c.Replace(call)
+		modified = true
+		m.rewrites++
 		return true
 	})
 
@@ -359,98 +1022,122 @@ func (m *MigrateStruct) RewriteTestFileRefactored(testFile string, StructDefs ma
 	return nil, nil
 }
 
-// RewriteHandlerStructs：構造体のリテラルを新しいコンストラクタに書き換え
-func (m *MigrateStruct) RewriteHandlerStructs(n ast.Node, StructDefs map[string]StructDef, usedStructs map[string][]string) bool {
-	modified := false
-
-	// 1) var 宣言の解析
-	if decl, ok := n.(*ast.GenDecl); ok && decl.Tok == token.VAR {
-		for _, spec := range decl.Specs {
-			if valueSpec, ok := spec.(*ast.ValueSpec); ok {
-				for i, value := range valueSpec.Values {
-					if compLit, ok := value.(*ast.CompositeLit); ok {
-						if newCall := m.processCompositeLit(compLit, StructDefs); newCall != nil {
-							valueSpec.Values[i] = newCall
-							modified = true
-						}
-					}
-				}
-			}
-		}
+// isPointerLit は `[]*pkg.XXX{{...}}` のように型を省略したポインタのリテラルかを判定する
+func isPointerLit(info *types.Info, cl *ast.CompositeLit) bool {
+	tv, ok := info.Types[cl]
+	if !ok {
+		return false
 	}
+	_, ok = tv.Type.(*types.Pointer)
+	return ok
+}
 
-	// 2) 代入式の処理
-	if assign, ok := n.(*ast.AssignStmt); ok {
-		for i, rhs := range assign.Rhs {
-			if compLit, ok := rhs.(*ast.CompositeLit); ok {
-				if newCall := m.processCompositeLit(compLit, StructDefs); newCall != nil {
-					assign.Rhs[i] = newCall
-					modified = true
-				}
-			}
+// keepsPointer は `x := pkg.XXX{...}` や `var x = pkg.XXX{...}` のように
+// 型を指定せずに変数を宣言していて、ポインタのまま扱える箇所かを判定する
+func keepsPointer(c *astutil.Cursor) bool {
+	switch parent := c.Parent().(type) {
+	case *ast.AssignStmt:
+		if c.Name() != "Rhs" {
+			return false
 		}
-	}
-
-	// 3) スライスや KeyValueExpr の処理
-	if compLit, ok := n.(*ast.CompositeLit); ok {
-		for _, el := range compLit.Elts {
-			if kv, ok := el.(*ast.KeyValueExpr); ok {
-				if rhs, ok := kv.Value.(*ast.CompositeLit); ok {
-					if newCall := m.processCompositeLit(rhs, StructDefs); newCall != nil {
-						kv.Value = newCall
-						modified = true
-					}
-				}
-			}
+		if parent.Tok == token.DEFINE {
+			return true
+		}
+		// `_ = pkg.XXX{...}` はどの型でも代入できる
+		if len(parent.Lhs) == len(parent.Rhs) {
+			ident, ok := parent.Lhs[c.Index()].(*ast.Ident)
+			return ok && ident.Name == "_"
 		}
+		return false
+	case *ast.ValueSpec:
+		return parent.Type == nil && c.Name() == "Values"
 	}
-
-	return modified
+	return false
 }
+
 func exprToString(expr ast.Expr) string {
 	var buf bytes.Buffer
 	_ = printer.Fprint(&buf, token.NewFileSet(), expr)
 	return buf.String()
 }
 
-func isUpperFirst(s string) bool {
-	if s == "" {
-		return false
+// qualifiedExpr は `pkg.Name[T1, T2]` の式を組み立てる
+func qualifiedExpr(pkgName, name string, typeArgs []ast.Expr) ast.Expr {
+	var expr ast.Expr = ast.NewIdent(name)
+	if pkgName != "" {
+		expr = &ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(name)}
+	}
+	switch len(typeArgs) {
+	case 0:
+		return expr
+	case 1:
+		return &ast.IndexExpr{X: expr, Index: typeArgs[0]}
+	default:
+		return &ast.IndexListExpr{X: expr, Indices: typeArgs}
 	}
-	r := []rune(s)
-	return unicode.IsUpper(r[0])
 }
 
 // `pkg.XXX{...}` → `pkg.XXX<suffix>(pkg.XXXParams<suffix>{...})` に書き換える
-func (m *MigrateStruct) processCompositeLit(cl *ast.CompositeLit, StructDefs map[string]StructDef) ast.Expr {
-	se, ok := cl.Type.(*ast.SelectorExpr)
-	if !ok {
+// 書き換えた式はポインタを返す
+func (m *MigrateStruct) processCompositeLit(cl *ast.CompositeLit, file *ast.File, pkg *packages.Package, StructDefs map[string]StructDef) ast.Expr {
+	tv, ok := pkg.TypesInfo.Types[cl]
+	if !ok || tv.Type == nil {
 		return nil
 	}
-	pkgIdent, ok := se.X.(*ast.Ident)
-	if !ok {
-		return nil
-	}
-	if pkgIdent.Name != m.targetpkg {
+	named := namedOf(tv.Type)
+	if named == nil || named.Obj().Pkg() == nil {
 		return nil
 	}
 
-	structName := fmt.Sprintf("%s.%s", pkgIdent.Name, se.Sel.Name)
+	structName := typeKey(named.Origin().Obj())
 	StructDef, found := StructDefs[structName]
-	if !found {
+	if !found || !m.isTarget(StructDef) {
+		return nil
+	}
+	// 同じパッケージでは非公開フィールドを参照できるため書き換えない
+	if pkg.PkgPath == StructDef.pkgPath {
+		return nil
+	}
+	if pos := m.fs.Position(cl.Pos()); !m.reachable(pos.Filename, StructDef) {
+		m.unreachable = append(m.unreachable, SkippedReference{File: pos.Filename, Line: pos.Line, Column: pos.Column, Symbol: structName})
+		return nil
+	}
+	pkgName, ok := importName(file, pkg, StructDef.pkgPath)
+	if !ok {
 		return nil
 	}
 
+	// ジェネリックな構造体はリテラルの型引数をそのまま渡す
+	qualifier := fileQualifier(file, pkg)
+	var typeArgs []ast.Expr
+	for i := 0; i < named.TypeArgs().Len(); i++ {
+		arg, err := parser.ParseExpr(types.TypeString(named.TypeArgs().At(i), qualifier))
+		if err != nil {
+			return nil
+		}
+		typeArgs = append(typeArgs, arg)
+	}
+	ref := func(name string) ast.Expr {
+		return qualifiedExpr(pkgName, name, typeArgs)
+	}
+
+	nakedStructName := named.Obj().Name()
+	switch m.style {
+	case StyleOptions:
+		return m.optionsCall(ref, nakedStructName, cl, StructDef)
+	case StyleBuilder:
+		return m.builderCall(ref, nakedStructName, cl, StructDef)
+	}
+
 	// --- フィールドを集める ---
 	// 元のリテラル中の "key: value" で key が小文字の場合、大文字に変換してやる
 	var newElts []ast.Expr
 	for _, el := range cl.Elts {
 		if kv, ok := el.(*ast.KeyValueExpr); ok {
 			if keyIdent, ok2 := kv.Key.(*ast.Ident); ok2 {
-				// フィールド名を Title 化 (repo -> Repo)
-				newKey := cases.Title(language.English).String(keyIdent.Name)
+				// フィールド名の先頭を大文字にする (repo -> Repo)
 				newElts = append(newElts, &ast.KeyValueExpr{
-					Key:   &ast.Ident{Name: newKey},
+					Key:   ast.NewIdent(exportedFieldName(keyIdent.Name)),
 					Value: kv.Value,
 				})
 			} else {
@@ -458,31 +1145,84 @@ func (m *MigrateStruct) processCompositeLit(cl *ast.CompositeLit, StructDefs map
 				newElts = append(newElts, el)
 			}
 		} else {
-			// key-value以外(配列リテラルなど)
+			// フィールド名を省略したリテラルはパラメータ構造体でも同じ順番になる
 			newElts = append(newElts, el)
 		}
 	}
 
-	nakedStructName := structName[strings.LastIndex(structName, ".")+1:]
-	paramsStructName := nakedStructName + "Params" + m.suffix
-
-	// コンストラクタ (例: handler.NewForTestXxx)
-	ctorFuncName := "New" + nakedStructName + m.suffix
-	call := &ast.CallExpr{
-		Fun: &ast.SelectorExpr{
-			X:   &ast.Ident{Name: StructDef.pkg}, // 例: "handler"
-			Sel: &ast.Ident{Name: ctorFuncName},  // 例: "NewForTestAdminToolDPaymentOfficeContractStateGET"
-		},
+	ctorFuncName, paramsStructName := m.constructorNames(nakedStructName)
+
+	// コンストラクタ (例: handler.NewXxxForTest(&handler.XxxParamsForTest{...}))
+	return &ast.CallExpr{
+		Fun: ref(ctorFuncName),
 		Args: []ast.Expr{
-			&ast.CompositeLit{
-				Type: &ast.SelectorExpr{
-					X:   &ast.Ident{Name: "&" + StructDef.pkg}, // "handler"
-					Sel: &ast.Ident{Name: paramsStructName},
+			&ast.UnaryExpr{
+				Op: token.AND,
+				X: &ast.CompositeLit{
+					Type: ref(paramsStructName),
+					Elts: newElts, // 大文字化した KeyValue を詰める
 				},
-				Elts: newElts, // 大文字化した KeyValue を詰める
 			},
 		},
 	}
+}
+
+// literalFields はリテラルに指定されたフィールド名と値を順番に返す
+// フィールド名を省略したリテラルは定義順のフィールドに対応させる
+func literalFields(cl *ast.CompositeLit, StructDef StructDef) ([]string, []ast.Expr, bool) {
+	var names []string
+	var values []ast.Expr
+	for i, el := range cl.Elts {
+		if kv, ok := el.(*ast.KeyValueExpr); ok {
+			keyIdent, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				return nil, nil, false
+			}
+			names = append(names, keyIdent.Name)
+			values = append(values, kv.Value)
+			continue
+		}
+		if i >= len(StructDef.fieldList) {
+			return nil, nil, false
+		}
+		names = append(names, StructDef.fieldList[i])
+		values = append(values, el)
+	}
+	return names, values, true
+}
 
+// `pkg.XXX{a: 1}` → `pkg.NewXXX<suffix>(pkg.WithXXXA<suffix>(1))` に書き換える
+func (m *MigrateStruct) optionsCall(ref func(string) ast.Expr, nakedStructName string, cl *ast.CompositeLit, StructDef StructDef) ast.Expr {
+	names, values, ok := literalFields(cl, StructDef)
+	if !ok {
+		return nil
+	}
+	ctorFuncName, _ := m.constructorNames(nakedStructName)
+	call := &ast.CallExpr{Fun: ref(ctorFuncName)}
+	for i, name := range names {
+		call.Args = append(call.Args, &ast.CallExpr{
+			Fun:  ref(m.optionFuncName(nakedStructName, name)),
+			Args: []ast.Expr{values[i]},
+		})
+	}
 	return call
 }
+
+// `pkg.XXX{a: 1}` → `pkg.NewXXXBuilder<suffix>().A(1).Build()` に書き換える
+func (m *MigrateStruct) builderCall(ref func(string) ast.Expr, nakedStructName string, cl *ast.CompositeLit, StructDef StructDef) ast.Expr {
+	names, values, ok := literalFields(cl, StructDef)
+	if !ok {
+		return nil
+	}
+	ctorFuncName, _ := m.constructorNames(nakedStructName)
+	var expr ast.Expr = &ast.CallExpr{Fun: ref(ctorFuncName)}
+	for i, name := range names {
+		expr = &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: expr, Sel: ast.NewIdent(exportedFieldName(name))},
+			Args: []ast.Expr{values[i]},
+		}
+	}
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{X: expr, Sel: ast.NewIdent("Build")},
+	}
+}
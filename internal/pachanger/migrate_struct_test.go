@@ -3,6 +3,7 @@ package pachanger_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/pyama86/pachanger/internal/pachanger"
@@ -10,9 +11,7 @@ import (
 )
 
 func TestMigrate(t *testing.T) {
-	workDir, err := os.Getwd()
-	assert.NoError(t, err)
-	workDir = filepath.Join(workDir, "testdata")
+	workDir := copyTestdata(t)
 
 	targetPkg := "migrate"
 	suffix := "ForTestMigrate"
@@ -47,7 +46,7 @@ func TestAddConstructorWithParamsStructRefactored(t *testing.T) {
 	fmt.Println(m)
 }
 `
-	err = os.WriteFile(filepath.Join(workDir, "migrate/struct.go"), []byte(structGoContent), 0644)
+	err := os.WriteFile(filepath.Join(workDir, "migrate/struct.go"), []byte(structGoContent), 0644)
 	assert.NoError(t, err)
 	err = os.WriteFile(filepath.Join(workDir, "migrate/struct_test.go"), []byte(structTestGoContent), 0644)
 	assert.NoError(t, err)
@@ -75,9 +74,9 @@ type MigrateStructParamsForTestMigrate struct {
 
 func NewMigrateStructForTestMigrate(params *MigrateStructParamsForTestMigrate) *MigrateStruct {
     return &MigrateStruct{
-        Foo: params.Foo,
-        Bar: params.Bar,
-        Foobar: params.Foobar,
+        foo: params.Foo,
+        bar: params.Bar,
+        foobar: params.Foobar,
     }
 }
 `
@@ -106,3 +105,415 @@ func TestAddConstructorWithParamsStructRefactored(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expectedStructTestGoContent, string(actualStructTestGoContent))
 }
+
+func TestMigrateSameNamePackages(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"a/model/item.go": "package model\n\nimport (\n\t\"time\"\n\n\tother \"example.com/mod/b/model\"\n)\n\ntype Item struct {\n\tname  string\n\tat    time.Time\n\towner *other.Item\n}\n",
+		"a/model/item_test.go": `package model_test
+
+import (
+	"testing"
+
+	"example.com/mod/a/model"
+)
+
+func TestItem(t *testing.T) {
+	_ = model.Item{}
+}
+`,
+		"b/model/item.go": "package model\n\ntype Item struct {\n\tcount int\n}\n",
+	})
+
+	ms, err := pachanger.NewMigrateStruct(workDir, "model", "ForTest")
+	assert.NoError(t, err)
+	assert.NoError(t, ms.Migrate(filepath.Join(workDir, "a/model/item_test.go")))
+
+	t.Run("import名に合わせて型が修飾される", func(t *testing.T) {
+		src, err := os.ReadFile(filepath.Join(workDir, "a/model/item.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(src), "At time.Time")
+		assert.Contains(t, string(src), "Owner *other.Item")
+	})
+
+	t.Run("同名の別パッケージは変更しない", func(t *testing.T) {
+		src, err := os.ReadFile(filepath.Join(workDir, "b/model/item.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, "package model\n\ntype Item struct {\n\tcount int\n}\n", string(src))
+	})
+}
+
+func TestMigrateStyle(t *testing.T) {
+	files := func() map[string]string {
+		return map[string]string{
+			"h/h.go": "package h\n\ntype Handler struct {\n\tname string\n\tage  int\n}\n",
+			"h/h_test.go": `package h_test
+
+import (
+	"testing"
+
+	"example.com/mod/h"
+)
+
+func TestHandler(t *testing.T) {
+	_ = h.Handler{name: "a", age: 1}
+}
+`,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		style    pachanger.ConstructorStyle
+		wantDecl []string
+		wantCall string
+	}{
+		{
+			name:     "options形式",
+			style:    pachanger.StyleOptions,
+			wantDecl: []string{"type HandlerOptionForTest func(*Handler)", "func WithHandlerNameForTest(v string) HandlerOptionForTest {", "func NewHandlerForTest(opts ...HandlerOptionForTest) *Handler {"},
+			wantCall: `_ = h.NewHandlerForTest(h.WithHandlerNameForTest("a"), h.WithHandlerAgeForTest(1))`,
+		},
+		{
+			name:     "builder形式",
+			style:    pachanger.StyleBuilder,
+			wantDecl: []string{"type HandlerBuilderForTest struct {", "func (b *HandlerBuilderForTest) Age(v int) *HandlerBuilderForTest {", "func (b *HandlerBuilderForTest) Build() *Handler {"},
+			wantCall: `_ = h.NewHandlerBuilderForTest().Name("a").Age(1).Build()`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := writeModule(t, files())
+			ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+			assert.NoError(t, err)
+			ms.SetStyle(tt.style)
+			assert.NoError(t, ms.Migrate(filepath.Join(workDir, "h/h_test.go")))
+
+			src, err := os.ReadFile(filepath.Join(workDir, "h/h.go"))
+			assert.NoError(t, err)
+			for _, want := range tt.wantDecl {
+				assert.Contains(t, string(src), want)
+			}
+
+			testSrc, err := os.ReadFile(filepath.Join(workDir, "h/h_test.go"))
+			assert.NoError(t, err)
+			assert.Contains(t, string(testSrc), tt.wantCall)
+		})
+	}
+}
+
+func TestMigrateAll(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"h/h.go":          "package h\n\ntype Handler struct {\n\tname string\n}\n\ntype Public struct {\n\tName string\n}\n",
+		"h/a_test.go":     "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestA(t *testing.T) {\n\t_ = h.Handler{name: \"a\"}\n\t_ = h.Public{Name: \"a\"}\n}\n",
+		"h/b_test.go":     "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestB(t *testing.T) {\n\t_ = h.Handler{name: \"b\"}\n}\n",
+		"other/o.go":      "package other\n\ntype Handler struct {\n\tname string\n}\n",
+		"other/o_test.go": "package other_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/other\"\n)\n\nfunc TestO(t *testing.T) {\n\t_ = other.Handler{name: \"o\"}\n}\n",
+	})
+
+	ms, err := pachanger.NewMigrateStruct(workDir, "./h/...", "ForTest")
+	assert.NoError(t, err)
+	ms.SetStyle(pachanger.StyleOptions)
+	summary, err := ms.MigrateAll()
+	assert.NoError(t, err)
+
+	t.Run("パターンに一致するパッケージのテストをすべて書き換える", func(t *testing.T) {
+		assert.Equal(t, []string{filepath.Join(workDir, "h/a_test.go"), filepath.Join(workDir, "h/b_test.go")}, summary.Files)
+		assert.Equal(t, 2, summary.Literals)
+		assert.Equal(t, []string{"example.com/mod/h.Handler"}, summary.Constructors)
+
+		src, err := os.ReadFile(filepath.Join(workDir, "h/h.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(string(src), "func NewHandlerForTest("))
+		assert.NotContains(t, string(src), "NewPublicForTest")
+	})
+
+	t.Run("パターン外のパッケージは変更しない", func(t *testing.T) {
+		src, err := os.ReadFile(filepath.Join(workDir, "other/o_test.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(src), `other.Handler{name: "o"}`)
+	})
+}
+
+func TestMigrateLiteralForms(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"g/g.go": "package g\n\ntype Base struct {\n\tid int\n}\n\ntype Box[T any] struct {\n\tv T\n}\n\ntype Item struct {\n\tBase\n\tcount int\n}\n\nfunc Use(i Item) int { return i.count }\n",
+		"g/g_test.go": `package g_test
+
+import (
+	"testing"
+
+	"example.com/mod/g"
+)
+
+func TestG(t *testing.T) {
+	b := g.Box[int]{v: 1}
+	items := []g.Item{{Base: g.Base{id: 1}, count: 2}, {g.Base{2}, 3}}
+	ptrs := map[string]*g.Item{"a": {count: 1}}
+	p := &g.Item{count: 4}
+	_ = g.Use(g.Item{count: 5})
+	_, _, _, _ = b, items, ptrs, p
+}
+`,
+	})
+
+	ms, err := pachanger.NewMigrateStruct(workDir, "g", "ForTest")
+	assert.NoError(t, err)
+	ms.SetStyle(pachanger.StyleOptions)
+	summary, err := ms.MigrateAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 8, summary.Literals)
+
+	src, err := os.ReadFile(filepath.Join(workDir, "g/g_test.go"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ジェネリックな構造体", "b := g.NewBoxForTest[int](g.WithBoxVForTest[int](1))"},
+		{"スライスの要素と埋め込みフィールドと位置指定のリテラル", "items := []g.Item{*g.NewItemForTest(g.WithItemBaseForTest(*g.NewBaseForTest(g.WithBaseIDForTest(1))), g.WithItemCountForTest(2)), *g.NewItemForTest(g.WithItemBaseForTest(*g.NewBaseForTest(g.WithBaseIDForTest(2))), g.WithItemCountForTest(3))}"},
+		{"型を省略したポインタのマップ要素", `ptrs := map[string]*g.Item{"a": g.NewItemForTest(g.WithItemCountForTest(1))}`},
+		{"アドレス演算子付きのリテラル", "p := g.NewItemForTest(g.WithItemCountForTest(4))"},
+		{"値として渡すリテラル", "_ = g.Use(*g.NewItemForTest(g.WithItemCountForTest(5)))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Contains(t, string(src), tt.want)
+		})
+	}
+
+	t.Run("ジェネリックな構造体の型パラメータを引き継ぐ", func(t *testing.T) {
+		src, err := os.ReadFile(filepath.Join(workDir, "g/g.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(src), "func NewBoxForTest[T any](opts ...BoxOptionForTest[T]) *Box[T] {")
+		assert.Contains(t, string(src), "func WithItemBaseForTest(v Base) ItemOptionForTest {")
+	})
+}
+
+func TestMigrateExportTest(t *testing.T) {
+	structGo := "package h\n\nimport tm \"time\"\n\ntype Handler struct {\n\tat tm.Time\n}\n"
+	workDir := writeModule(t, map[string]string{
+		"h/h.go":      structGo,
+		"h/h_test.go": "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestH(t *testing.T) {\n\t_ = h.Handler{}\n}\n",
+	})
+
+	ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+	assert.NoError(t, err)
+	ms.SetExportTest(true)
+	assert.NoError(t, ms.Migrate(filepath.Join(workDir, "h/h_test.go")))
+
+	t.Run("本番のコードは変更しない", func(t *testing.T) {
+		src, err := os.ReadFile(filepath.Join(workDir, "h/h.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, structGo, string(src))
+	})
+
+	t.Run("export_test.goにコンストラクタを生成する", func(t *testing.T) {
+		src, err := os.ReadFile(filepath.Join(workDir, "h/export_test.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(src), "package h\n")
+		assert.Contains(t, string(src), "import tm \"time\"")
+		assert.Contains(t, string(src), "\tAt tm.Time\n")
+		assert.Contains(t, string(src), "func NewHandlerForTest(params *HandlerParamsForTest) *Handler {")
+	})
+
+	t.Run("別のディレクトリのテストは書き換えずに報告する", func(t *testing.T) {
+		appTest := "package app_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestApp(t *testing.T) {\n\t_ = h.Handler{}\n}\n"
+		workDir := writeModule(t, map[string]string{
+			"h/h.go":          structGo,
+			"app/app_test.go": appTest,
+		})
+		ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+		assert.NoError(t, err)
+		ms.SetExportTest(true)
+		summary, err := ms.MigrateAll()
+		assert.NoError(t, err)
+		assert.Empty(t, summary.Files)
+		assert.Empty(t, summary.Constructors)
+		assert.Equal(t, []pachanger.SkippedReference{{File: filepath.Join(workDir, "app/app_test.go"), Line: 10, Column: 6, Symbol: "example.com/mod/h.Handler"}}, summary.Unreachable)
+
+		src, err := os.ReadFile(filepath.Join(workDir, "app/app_test.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, appTest, string(src))
+		assert.NoFileExists(t, filepath.Join(workDir, "h/export_test.go"))
+	})
+}
+
+func TestMigrateVerify(t *testing.T) {
+	// x がポインタになるため、値として使っている箇所がコンパイルできなくなる
+	workDir := writeModule(t, map[string]string{
+		"h/h.go":      "package h\n\ntype Handler struct {\n\tname string\n}\n",
+		"h/h_test.go": "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestH(t *testing.T) {\n\tx := h.Handler{}\n\tvar y h.Handler = x\n\t_ = y\n}\n",
+	})
+	ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+	assert.NoError(t, err)
+	err = ms.Migrate(filepath.Join(workDir, "h/h_test.go"))
+	assert.ErrorContains(t, err, "does not compile")
+	assert.ErrorContains(t, err, filepath.Join(workDir, "h/h_test.go")+":11:")
+}
+
+func TestMigrateRoundTripTest(t *testing.T) {
+	testGo := "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestH(t *testing.T) {\n\t_ = h.Handler{}\n}\n"
+
+	t.Run("略語を含むフィールド名を公開名に変換する", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"h/h.go":      "package h\n\ntype Handler struct {\n\tid     int\n\tapiURL string\n\tuserId int\n}\n",
+			"h/h_test.go": testGo,
+		})
+		ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+		assert.NoError(t, err)
+		ms.SetRoundTripTest(true)
+		assert.NoError(t, ms.Migrate(filepath.Join(workDir, "h/h_test.go")))
+
+		src, err := os.ReadFile(filepath.Join(workDir, "h/h.go"))
+		assert.NoError(t, err)
+		for _, want := range []string{"    ID int\n", "    APIURL string\n", "    UserID int\n", "        id: params.ID,\n", "        apiURL: params.APIURL,\n", "        userId: params.UserID,\n"} {
+			assert.Contains(t, string(src), want)
+		}
+
+		test, err := os.ReadFile(filepath.Join(workDir, "h/h_roundtrip_test.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(test), "func TestNewHandlerForTestRoundTrip(t *testing.T) {")
+		assert.Contains(t, string(test), "\tif !reflect.DeepEqual(got.apiURL, v1) {\n")
+	})
+
+	t.Run("公開名が重複する場合はエラー", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"h/h.go":      "package h\n\ntype Handler struct {\n\tid int\n\tiD int\n}\n",
+			"h/h_test.go": testGo,
+		})
+		ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+		assert.NoError(t, err)
+		assert.ErrorContains(t, ms.Migrate(filepath.Join(workDir, "h/h_test.go")), "both map to ID")
+	})
+}
+
+func TestMigrateRevert(t *testing.T) {
+	structGo := "package h\n\ntype Handler struct {\n\tname string\n\tuserId int\n}\n"
+	testGo := "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestH(t *testing.T) {\n\tx := h.Handler{name: \"a\", userId: 1}\n\t_ = []h.Handler{{name: \"b\"}}\n\t_ = x\n}\n"
+
+	for _, style := range []pachanger.ConstructorStyle{pachanger.StyleParams, pachanger.StyleOptions, pachanger.StyleBuilder} {
+		t.Run(string(style)+"形式のコンストラクタをリテラルに戻す", func(t *testing.T) {
+			workDir := writeModule(t, map[string]string{
+				"h/h.go":      structGo,
+				"h/h_test.go": testGo,
+			})
+			ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+			assert.NoError(t, err)
+			ms.SetStyle(style)
+			ms.SetExportTest(true)
+			_, err = ms.MigrateAll()
+			assert.NoError(t, err)
+
+			summary, err := ms.RevertAll()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"example.com/mod/h.Handler"}, summary.Constructors)
+			assert.Equal(t, 2, summary.Literals)
+
+			src, err := os.ReadFile(filepath.Join(workDir, "h/h_test.go"))
+			assert.NoError(t, err)
+			assert.Contains(t, string(src), `x := &h.Handler{name: "a", userId: 1}`)
+			assert.Contains(t, string(src), `_ = []h.Handler{h.Handler{name: "b"}}`)
+
+			_, err = os.Stat(filepath.Join(workDir, "h/export_test.go"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+
+	t.Run("戻せない呼び出しが残る場合は宣言を削除しない", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"h/h.go":      structGo,
+			"h/h_test.go": testGo,
+			"h/p_test.go": "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestP(t *testing.T) {\n\tp := &h.HandlerParamsForTest{Name: \"p\"}\n\t_ = h.NewHandlerForTest(p)\n}\n",
+		})
+		ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+		assert.NoError(t, err)
+		assert.NoError(t, ms.Migrate(filepath.Join(workDir, "h/h_test.go")))
+
+		summary, err := ms.RevertAll()
+		assert.NoError(t, err)
+		assert.Empty(t, summary.Constructors)
+
+		src, err := os.ReadFile(filepath.Join(workDir, "h/h.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(src), "func NewHandlerForTest(params *HandlerParamsForTest) *Handler {")
+	})
+
+	t.Run("生成したものと同じ形の宣言だけを削除する", func(t *testing.T) {
+		// 生成する名前と同じだが、手で書いたテスト
+		handWritten := "package h\n\nimport \"testing\"\n\nfunc TestNewHandlerForTestRoundTrip(t *testing.T) {\n\tif (Handler{}).name != \"\" {\n\t\tt.Fatal(\"name\")\n\t}\n}\n"
+		workDir := writeModule(t, map[string]string{
+			"h/h.go":           structGo,
+			"h/h_test.go":      testGo,
+			"h/manual_test.go": handWritten,
+		})
+		ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+		assert.NoError(t, err)
+		assert.NoError(t, ms.Migrate(filepath.Join(workDir, "h/h_test.go")))
+
+		summary, err := ms.RevertAll()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"example.com/mod/h.Handler"}, summary.Constructors)
+
+		src, err := os.ReadFile(filepath.Join(workDir, "h/h.go"))
+		assert.NoError(t, err)
+		assert.NotContains(t, string(src), "HandlerForTest")
+		manual, err := os.ReadFile(filepath.Join(workDir, "h/manual_test.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, handWritten, string(manual))
+	})
+
+	t.Run("生成した往復テストも削除する", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"h/h.go":      structGo,
+			"h/h_test.go": testGo,
+		})
+		ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+		assert.NoError(t, err)
+		ms.SetRoundTripTest(true)
+		assert.NoError(t, ms.Migrate(filepath.Join(workDir, "h/h_test.go")))
+
+		summary, err := ms.RevertAll()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"example.com/mod/h.Handler"}, summary.Constructors)
+		assert.NoFileExists(t, filepath.Join(workDir, "h/h_roundtrip_test.go"))
+	})
+}
+
+func TestMigrateAllWithoutFile(t *testing.T) {
+	workDir := writeModule(t, map[string]string{
+		"h/h.go":          "package h\n\ntype Handler struct {\n\tname string\n}\n",
+		"h/h_test.go":     "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestH(t *testing.T) {\n\t_ = h.Handler{name: \"h\"}\n}\n",
+		"app/app.go":      "package app\n",
+		"app/app_test.go": "package app\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestApp(t *testing.T) {\n\t_ = h.Handler{}\n}\n",
+	})
+
+	// --file を指定しない場合は、モジュール内のすべてのテストファイルから対象パッケージの構造体を探す
+	ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+	assert.NoError(t, err)
+	summary, err := ms.MigrateAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(workDir, "app/app_test.go"), filepath.Join(workDir, "h/h_test.go")}, summary.Files)
+	assert.Equal(t, 2, summary.Literals)
+}
+
+func TestMigrateStructExportedFieldsOnly(t *testing.T) {
+	files := map[string]string{
+		"h/h.go":      "package h\n\ntype Public struct {\n\tName string\n}\n",
+		"h/h_test.go": "package h_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/h\"\n)\n\nfunc TestH(t *testing.T) {\n\t_ = h.Public{Name: \"h\"}\n}\n",
+	}
+	workDir := writeModule(t, files)
+
+	// 公開フィールドのみの構造体はパッケージ外からもリテラルで生成できるため書き換えない
+	ms, err := pachanger.NewMigrateStruct(workDir, "h", "ForTest")
+	assert.NoError(t, err)
+	summary, err := ms.MigrateFiles([]string{filepath.Join(workDir, "h/h_test.go")})
+	assert.NoError(t, err)
+	assert.Empty(t, summary.Constructors)
+	assert.Zero(t, summary.Literals)
+	for name, content := range files {
+		src, err := os.ReadFile(filepath.Join(workDir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(src), name)
+	}
+}
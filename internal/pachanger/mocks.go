@@ -0,0 +1,252 @@
+package pachanger
+
+import (
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// MockFile は移動するインターフェースのモックとして生成されたファイル
+type MockFile struct {
+	Path string
+	// モックしているインターフェースを宣言している移動するファイル
+	Target     string
+	Interfaces []string
+	// 移動先のインターフェースの隣へ移動する場合の出力先。移動しない場合は空
+	Output string
+}
+
+// SetMoveMocks はインターフェースと同じパッケージに生成されたモックを、インターフェースと一緒に移動するようにする
+func (t *Transformer) SetMoveMocks(moveMocks bool) {
+	t.moveMocks = moveMocks
+}
+
+// mockGenerators はモックを生成するツールの名前。生成されたファイルのヘッダーの生成元と比べる
+var mockGenerators = []string{"mockgen", "moq", "mockery"}
+
+// FindMocks は targets で宣言されたインターフェースのモックとして生成されたファイルを返す
+// targets のキーは移動するファイル、値は出力先のパス
+// "// Code generated" のヘッダーを持ち、"// Source:" か生成コマンドの -source でターゲットファイルを指しているか、
+// モックの生成ツールで生成されていてインターフェースを参照しているものをモックとみなす
+// protobuf などのほかの生成されたファイルはインターフェースを参照していても移動しない
+func (t *Transformer) FindMocks(targets map[string]string) ([]MockFile, error) {
+	// 移動するファイルで宣言されたインターフェース
+	interfaces := map[types.Object]string{}
+	for target := range targets {
+		_, pkg, err := t.findPackageForFile(target)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range pkg.TypesInfo.Defs {
+			if typeName, ok := obj.(*types.TypeName); ok && typeName.Parent() == typeName.Pkg().Scope() && types.IsInterface(typeName.Type()) && t.fs.Position(obj.Pos()).Filename == target {
+				interfaces[obj] = target
+			}
+		}
+	}
+
+	generatedBy := t.mockCommands(targets)
+	found := map[string]*MockFile{}
+	for _, pkg := range t.allPkgs {
+		for _, file := range pkg.Syntax {
+			filename := t.fs.Position(file.Pos()).Filename
+			if _, ok := targets[filename]; ok || !ast.IsGenerated(file) {
+				continue
+			}
+			source := mockTarget(filename, file, targets)
+			if source == "" {
+				source = generatedBy[filename]
+			}
+			if source == "" && !isMockGenerator(file) {
+				continue
+			}
+			mock := found[filename]
+			if mock == nil {
+				mock = &MockFile{Path: filename}
+			}
+			for ident, obj := range pkg.TypesInfo.Uses {
+				if target, ok := interfaces[obj]; ok && (source == "" || target == source) && !slices.Contains(mock.Interfaces, obj.Name()) && t.fs.Position(ident.Pos()).Filename == filename {
+					mock.Target = target
+					mock.Interfaces = append(mock.Interfaces, obj.Name())
+				}
+			}
+			if mock.Target == "" {
+				mock.Target = source
+			}
+			if mock.Target == "" {
+				continue
+			}
+			// インターフェースと同じパッケージに生成されたモックだけを移動する
+			output := targets[mock.Target]
+			if t.moveMocks && filepath.Dir(filename) == filepath.Dir(mock.Target) && filepath.Dir(output) != filepath.Dir(mock.Target) && !strings.HasSuffix(pkg.Name, "_test") {
+				mock.Output = filepath.Join(filepath.Dir(output), filepath.Base(filename))
+			}
+			slices.Sort(mock.Interfaces)
+			found[filename] = mock
+		}
+	}
+
+	var mocks []MockFile
+	for _, mock := range found {
+		mocks = append(mocks, *mock)
+	}
+	slices.SortFunc(mocks, func(a, b MockFile) int { return strings.Compare(a.Path, b.Path) })
+	return mocks, nil
+}
+
+// isMockGenerator はヘッダーの生成元がモックの生成ツールかを判定する
+func isMockGenerator(file *ast.File) bool {
+	generator := strings.ToLower(generatorName(file))
+	for _, word := range strings.FieldsFunc(generator, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if slices.Contains(mockGenerators, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// mockTarget は生成されたファイルのヘッダーの "// Source:" が指す移動するファイルを返す。なければ空
+func mockTarget(filename string, file *ast.File, targets map[string]string) string {
+	source := mockSource(file)
+	if source == "" {
+		return ""
+	}
+	// 生成ファイルからの相対パスか、生成コマンドを実行したインターフェースのディレクトリからの相対パス
+	if p := filepath.Join(filepath.Dir(filename), filepath.FromSlash(source)); targets[p] != "" {
+		return p
+	}
+	for target := range targets {
+		if filepath.Join(filepath.Dir(target), filepath.FromSlash(source)) == target {
+			return target
+		}
+	}
+	return ""
+}
+
+// mockCommands は -source で移動するファイルを指している go:generate コマンドを探し、
+// コマンドの引数に書かれたファイル(生成先) -> 移動するファイルを返す
+func (t *Transformer) mockCommands(targets map[string]string) map[string]string {
+	generatedBy := map[string]string{}
+	seen := map[string]bool{}
+	for _, pkg := range t.allPkgs {
+		for _, file := range pkg.Syntax {
+			filename := t.fs.Position(file.Pos()).Filename
+			if seen[filename] {
+				continue
+			}
+			seen[filename] = true
+			dir := filepath.Dir(filename)
+			for _, group := range file.Comments {
+				for _, c := range group.List {
+					command, ok := strings.CutPrefix(c.Text, "//go:generate ")
+					if !ok {
+						continue
+					}
+					var source string
+					var args []string
+					words := strings.Fields(command)
+					for i, word := range words {
+						if _, value, ok := strings.Cut(word, "="); ok && strings.HasPrefix(word, "-") {
+							word = value
+						}
+						p := filepath.Join(dir, filepath.FromSlash(word))
+						if i > 0 && (words[i-1] == "-source" || strings.HasPrefix(words[i], "-source=")) {
+							source = p
+						} else {
+							args = append(args, p)
+						}
+					}
+					if targets[source] == "" {
+						continue
+					}
+					for _, arg := range args {
+						generatedBy[arg] = source
+					}
+				}
+			}
+		}
+	}
+	return generatedBy
+}
+
+// mockSource は mockgen が生成したファイルの "// Source: user.go" に書かれたソースファイルを返す
+func mockSource(file *ast.File) string {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if source, ok := strings.CutPrefix(c.Text, "// Source: "); ok {
+				// reflect モードでは "// Source: example.com/mod/model (interfaces: User)" のようになる
+				if strings.HasSuffix(source, ".go") {
+					return strings.TrimSpace(source)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// rewriteMockHeader は生成されたモックのヘッダーにある、移動したファイルを指す "// Source:" と
+// 生成コマンドの -source を書き換える。移動するモックでは -package も新しいパッケージ名にする
+func (t *Transformer) rewriteMockHeader(filename string, file *ast.File, isTarget bool) bool {
+	dir := filepath.Dir(filename)
+	if !isTarget {
+		dir = t.finalDir(filename, false)
+	}
+	finalDir := t.finalDir(filename, isTarget)
+	rewriteSource := func(p string) string {
+		abs := filepath.Join(dir, filepath.FromSlash(p))
+		if out, ok := t.movedPath(abs); ok {
+			return relPath(finalDir, out)
+		}
+		if isTarget {
+			return relPath(finalDir, abs)
+		}
+		// 生成コマンドはインターフェースのディレクトリで実行されるため、そこからの相対パスの場合がある
+		for original, out := range t.MovedFiles() {
+			if filepath.Join(filepath.Dir(original), filepath.FromSlash(p)) == original {
+				return filepath.Base(out)
+			}
+		}
+		return p
+	}
+
+	modified := false
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			text := c.Text
+			if source, ok := strings.CutPrefix(text, "// Source: "); ok && strings.HasSuffix(source, ".go") {
+				text = "// Source: " + rewriteSource(strings.TrimSpace(source))
+			} else if command, ok := strings.CutPrefix(text, "//\t"); ok && strings.Contains(command, "-source") {
+				words := strings.Fields(command)
+				for i, word := range words {
+					switch {
+					case strings.HasPrefix(word, "-source="):
+						words[i] = "-source=" + rewriteSource(strings.TrimPrefix(word, "-source="))
+					case word == "-source" && i+1 < len(words):
+						words[i+1] = rewriteSource(words[i+1])
+					case isTarget && word == "-package="+t.oldPkg:
+						words[i] = "-package=" + t.newPkg
+					case isTarget && word == "-package" && i+1 < len(words) && words[i+1] == t.oldPkg:
+						words[i+1] = t.newPkg
+					}
+				}
+				if !slices.Equal(words, strings.Fields(command)) {
+					text = "//\t" + strings.Join(words, " ")
+				}
+			}
+			if text != c.Text {
+				debugf("Update mock header %q -> %q", c.Text, text)
+				c.Text = text
+				modified = true
+			}
+		}
+	}
+	return modified
+}
@@ -0,0 +1,79 @@
+package pachanger_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMocks(t *testing.T) {
+	files := map[string]string{
+		"model/user.go": "package model\n\n//go:generate mockgen -source=user.go -destination=mock_user.go -package=model\n\ntype User interface{ Name() string }\n",
+		"model/base.go": "package model\n\ntype Base struct{}\n",
+		"model/mock_user.go": "// Code generated by MockGen. DO NOT EDIT.\n// Source: user.go\n//\n// Generated by this command:\n//\n//\tmockgen -source=user.go -destination=mock_user.go -package=model\n//\n\n" +
+			"package model\n\ntype MockUser struct{}\n\nfunc (m *MockUser) Name() string { return \"\" }\n\nvar _ User = (*MockUser)(nil)\n",
+		"mocks/user.go": "// Code generated by MockGen. DO NOT EDIT.\n// Source: ../model/user.go\n\n" +
+			"package mocks\n\nimport \"example.com/mod/model\"\n\ntype MockUser struct{}\n\nfunc (m *MockUser) Name() string { return \"\" }\n\nvar _ model.User = (*MockUser)(nil)\n",
+	}
+
+	t.Run("移動するモックを探す場合", func(t *testing.T) {
+		workDir := writeModule(t, files)
+		target := filepath.Join(workDir, "model/user.go")
+		transformer, err := pachanger.NewTransformer(workDir, "user", "", "", nil)
+		assert.NoError(t, err)
+		transformer.SetMoveMocks(true)
+		mocks, err := transformer.FindMocks(map[string]string{target: filepath.Join(workDir, "model/user/user.go")})
+		assert.NoError(t, err)
+		assert.Equal(t, []pachanger.MockFile{
+			{Path: filepath.Join(workDir, "mocks/user.go"), Target: target, Interfaces: []string{"User"}},
+			{Path: filepath.Join(workDir, "model/mock_user.go"), Target: target, Interfaces: []string{"User"}, Output: filepath.Join(workDir, "model/user/mock_user.go")},
+		}, mocks)
+	})
+
+	t.Run("モックを移動する場合", func(t *testing.T) {
+		cfg := moveConfig{setup: func(transformer *pachanger.Transformer) { transformer.SetMoveMocks(true) }}
+		_, _, read := moveAndRead(t, files, cfg, "model/user.go", "model/user/user.go", "model/base.go", "model/mock_user.go", "mocks/user.go")
+
+		mock := read("model/user/mock_user.go")
+		assert.Contains(t, mock, "// Source: user.go\n")
+		assert.Contains(t, mock, "//\tmockgen -source=user.go -destination=mock_user.go -package=user\n")
+		assert.Contains(t, mock, "var _ User = (*MockUser)(nil)\n")
+		assert.Contains(t, read("model/user/user.go"), "//go:generate mockgen -source=user.go -destination=mock_user.go -package=user\n")
+		assert.Contains(t, read("mocks/user.go"), "// Source: ../model/user/user.go\n")
+		assert.Contains(t, read("mocks/user.go"), "var _ user.User = (*MockUser)(nil)\n")
+	})
+
+	t.Run("モックを移動しない場合", func(t *testing.T) {
+		workDir := writeModule(t, files)
+		target := filepath.Join(workDir, "model/user.go")
+		transformer, err := pachanger.NewTransformer(workDir, "user", "", "", nil)
+		assert.NoError(t, err)
+		mocks, err := transformer.FindMocks(map[string]string{target: filepath.Join(workDir, "model/user/user.go")})
+		assert.NoError(t, err)
+		if assert.Len(t, mocks, 2) {
+			assert.Empty(t, mocks[1].Output)
+		}
+	})
+
+	t.Run("モックの生成元で見分ける場合", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"model/user.go": "package model\n\n//go:generate go run example.com/gen -source=user.go -out=../fakes/user.go\n\ntype User interface{ Name() string }\n",
+			// インターフェースを参照していてもモックではない
+			"model/user.pb.go": "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage model\n\nvar _ User = (*UserPB)(nil)\n\ntype UserPB struct{}\n\nfunc (*UserPB) Name() string { return \"\" }\n",
+			"moqs/user.go":     "// Code generated by moq; DO NOT EDIT.\n\npackage moqs\n\nimport \"example.com/mod/model\"\n\nvar _ model.User = (*UserMock)(nil)\n\ntype UserMock struct{}\n\nfunc (*UserMock) Name() string { return \"\" }\n",
+			// モックの生成ツールでなくても、-source で移動するファイルを指すコマンドで生成されている
+			"fakes/user.go": "// Code generated by gen. DO NOT EDIT.\n\npackage fakes\n\ntype FakeUser struct{}\n",
+		})
+		target := filepath.Join(workDir, "model/user.go")
+		transformer, err := pachanger.NewTransformer(workDir, "user", "", "", nil)
+		assert.NoError(t, err)
+		mocks, err := transformer.FindMocks(map[string]string{target: filepath.Join(workDir, "model/user/user.go")})
+		assert.NoError(t, err)
+		assert.Equal(t, []pachanger.MockFile{
+			{Path: filepath.Join(workDir, "fakes/user.go"), Target: target},
+			{Path: filepath.Join(workDir, "moqs/user.go"), Target: target, Interfaces: []string{"User"}},
+		}, mocks)
+	})
+}
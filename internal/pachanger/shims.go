@@ -0,0 +1,257 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/types"
+	"go/version"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
+)
+
+// shimTarget は移動元のパッケージに残す互換用の宣言の情報
+type shimTarget struct {
+	// 移動前のファイルのパス。互換用の宣言はこのパスに書き出す
+	oldPath    string
+	oldPkg     *types.Package
+	newPkg     string
+	newPkgPath string
+	objs       []types.Object
+	// エイリアスに型パラメータを書けるか(go 1.24 以降)
+	genericAlias bool
+}
+
+// SetLeaveShims は移動元のパッケージに、移動したシンボルへ転送する非推奨の宣言を残すようにする
+// モジュール外の利用者が移行するまでコンパイルできる状態を保つために使う
+func (t *Transformer) SetLeaveShims(leaveShims bool) {
+	t.leaveShims = leaveShims
+}
+
+// recordShims はターゲットファイルの公開シンボルを互換用の宣言として残せるかを確かめ、記録する
+// 移動先のパッケージが移動元のパッケージを import することになる場合は循環参照になるためエラーを返す
+func (t *Transformer) recordShims(target, output, goVersion string, pkg *packages.Package) error {
+	if strings.HasSuffix(target, "_test.go") {
+		return nil
+	}
+	if filepath.Dir(target) == filepath.Dir(output) {
+		return fmt.Errorf("cannot leave shims for %s: the file stays in the directory of %s", target, t.oldPkgPath)
+	}
+
+	// 移動するファイルが移動元に残るシンボルを使っていると、移動先が移動元を import する
+	for ident, obj := range pkg.TypesInfo.Uses {
+		if obj.Pkg() != pkg.Types || obj.Parent() != pkg.Types.Scope() || t.fs.Position(ident.Pos()).Filename != target {
+			continue
+		}
+		declFile := t.fs.Position(obj.Pos()).Filename
+		if declFile == target {
+			continue
+		}
+		if done := t.getDoneFile(declFile); done != nil && filepath.Dir(done.output) == filepath.Dir(output) {
+			continue
+		}
+		return fmt.Errorf("cannot leave shims: %s would import %s for %s while %s imports %s (import cycle)", t.newPkgPath, t.oldPkgPath, obj.Name(), t.oldPkgPath, t.newPkgPath)
+	}
+	for _, p := range t.allPkgs {
+		if p.PkgPath == t.newPkgPath && importsPackage(p, t.oldPkgPath, map[string]bool{}) {
+			return fmt.Errorf("cannot leave shims: %s already imports %s (import cycle)", t.newPkgPath, t.oldPkgPath)
+		}
+	}
+
+	shim := shimTarget{
+		oldPath:      target,
+		oldPkg:       pkg.Types,
+		newPkg:       t.newPkg,
+		newPkgPath:   t.newPkgPath,
+		genericAlias: goVersion != "" && version.Compare("go"+goVersion, "go1.24") >= 0,
+	}
+	for name := range t.targetSymbols {
+		obj := pkg.Types.Scope().Lookup(name)
+		if obj == nil || t.fs.Position(obj.Pos()).Filename != target {
+			continue
+		}
+		if named, ok := obj.Type().(*types.Named); ok && named.TypeParams().Len() > 0 && !shim.genericAlias {
+			return fmt.Errorf("cannot leave a shim for generic type %s: type parameters on aliases require go 1.24", name)
+		}
+		// 変数は値をコピーすると移動先と別の状態になるため残さず、利用者が書き換えるよう報告する
+		if _, ok := obj.(*types.Var); ok {
+			pos := t.fs.Position(obj.Pos())
+			t.unshimmedVars = append(t.unshimmedVars, SkippedReference{File: pos.Filename, Line: pos.Line, Column: pos.Column, Symbol: t.oldPkgPath + "." + name})
+			continue
+		}
+		shim.objs = append(shim.objs, obj)
+	}
+	slices.SortFunc(shim.objs, func(a, b types.Object) int { return strings.Compare(a.Name(), b.Name()) })
+	t.shims = append(t.shims, shim)
+	return nil
+}
+
+// UnshimmedVars は互換用の宣言を残さなかった変数を返す
+// 移動元のパッケージを経由して変数を読み書きしている利用者は、移動先を直接使うよう書き換える必要がある
+func (t *Transformer) UnshimmedVars() []SkippedReference {
+	vars := slices.Clone(t.unshimmedVars)
+	slices.SortFunc(vars, func(a, b SkippedReference) int { return strings.Compare(a.Symbol, b.Symbol) })
+	return vars
+}
+
+// importsPackage は pkg が importPath を直接または間接に import しているかを返す
+func importsPackage(pkg *packages.Package, importPath string, seen map[string]bool) bool {
+	if seen[pkg.PkgPath] {
+		return false
+	}
+	seen[pkg.PkgPath] = true
+	for _, imp := range pkg.Imports {
+		if imp.PkgPath == importPath || importsPackage(imp, importPath, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteShims は記録した互換用の宣言を移動前のファイルのパスに書き出し、書き出したファイルを返す
+// ターゲットファイルを削除した後に呼び出す
+func (t *Transformer) WriteShims() ([]string, error) {
+	var written []string
+	for _, shim := range t.shims {
+		if _, err := os.Stat(shim.oldPath); err == nil {
+			return written, fmt.Errorf("cannot leave shims: %s still exists", shim.oldPath)
+		}
+		src, shimImports, err := t.shimCode(shim)
+		if err != nil {
+			return written, err
+		}
+		code, err := addImports(shim.oldPath, src, shimImports)
+		if err != nil {
+			return written, err
+		}
+		// 標準ライブラリとそれ以外の import を分ける
+		formatted, err := imports.Process(shim.oldPath, []byte(code), &imports.Options{Comments: true, TabWidth: 8, FormatOnly: true})
+		if err != nil {
+			return written, fmt.Errorf("failed to format %s: %w", shim.oldPath, err)
+		}
+		if err := t.journal.RecordFile(shim.oldPath); err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(shim.oldPath, formatted, 0644); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", shim.oldPath, err)
+		}
+		written = append(written, shim.oldPath)
+	}
+	return written, nil
+}
+
+// shimCode は移動したシンボルへ転送する宣言を生成する
+func (t *Transformer) shimCode(shim shimTarget) (string, map[string]string, error) {
+	imports := map[string]string{shim.newPkgPath: ""}
+	if path.Base(shim.newPkgPath) != shim.newPkg {
+		imports[shim.newPkgPath] = shim.newPkg
+	}
+	// 移動したシンボルは同じ名前のエイリアスが残るため、移動元の型は修飾しない
+	qualifier := func(p *types.Package) string {
+		if p == shim.oldPkg {
+			return ""
+		}
+		imports[p.Path()] = ""
+		return p.Name()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n", shim.oldPkg.Name())
+	for _, obj := range shim.objs {
+		newName := shim.newPkg + "." + t.transformSymbolName(obj.Name())
+		fmt.Fprintf(&b, "\n// Deprecated: use %s\n", newName)
+		switch obj := obj.(type) {
+		case *types.TypeName:
+			named, ok := obj.Type().(*types.Named)
+			if !ok || named.TypeParams().Len() == 0 {
+				fmt.Fprintf(&b, "type %s = %s\n", obj.Name(), newName)
+				break
+			}
+			var params, args []string
+			for i := 0; i < named.TypeParams().Len(); i++ {
+				tp := named.TypeParams().At(i)
+				params = append(params, tp.Obj().Name()+" "+types.TypeString(tp.Constraint(), qualifier))
+				args = append(args, tp.Obj().Name())
+			}
+			fmt.Fprintf(&b, "type %s[%s] = %s[%s]\n", obj.Name(), strings.Join(params, ", "), newName, strings.Join(args, ", "))
+		case *types.Func:
+			sig := obj.Type().(*types.Signature)
+			if spellable(sig, shim.oldPkg, map[types.Type]bool{}) {
+				b.WriteString(forwardFunc("", obj.Name(), newName, sig, qualifier))
+				break
+			}
+			// 移動した非公開の型を使うシグネチャは移動元で書けないため、関数の値を転送する
+			if sig.TypeParams().Len() > 0 {
+				return "", nil, fmt.Errorf("cannot leave a shim for %s: its signature uses unexported types of %s", obj.Name(), shim.oldPkg.Path())
+			}
+			fmt.Fprintf(&b, "var %s = %s\n", obj.Name(), newName)
+		case *types.Const:
+			fmt.Fprintf(&b, "const %s = %s\n", obj.Name(), newName)
+		}
+	}
+	return b.String(), imports, nil
+}
+
+// spellable は型が pkg の非公開の型を使わずに pkg の中で書けるかを判定する
+func spellable(t types.Type, pkg *types.Package, seen map[types.Type]bool) bool {
+	if seen[t] {
+		return true
+	}
+	seen[t] = true
+	switch u := types.Unalias(t).(type) {
+	case *types.Named:
+		if u.Obj().Pkg() == pkg && !u.Obj().Exported() {
+			return false
+		}
+		for i := 0; i < u.TypeArgs().Len(); i++ {
+			if !spellable(u.TypeArgs().At(i), pkg, seen) {
+				return false
+			}
+		}
+	case *types.Pointer:
+		return spellable(u.Elem(), pkg, seen)
+	case *types.Slice:
+		return spellable(u.Elem(), pkg, seen)
+	case *types.Array:
+		return spellable(u.Elem(), pkg, seen)
+	case *types.Chan:
+		return spellable(u.Elem(), pkg, seen)
+	case *types.Map:
+		return spellable(u.Key(), pkg, seen) && spellable(u.Elem(), pkg, seen)
+	case *types.Signature:
+		for i := 0; i < u.TypeParams().Len(); i++ {
+			if !spellable(u.TypeParams().At(i).Constraint(), pkg, seen) {
+				return false
+			}
+		}
+		for _, tuple := range []*types.Tuple{u.Params(), u.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				if !spellable(tuple.At(i).Type(), pkg, seen) {
+					return false
+				}
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if !spellable(u.Field(i).Type(), pkg, seen) {
+				return false
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < u.NumEmbeddeds(); i++ {
+			if !spellable(u.EmbeddedType(i), pkg, seen) {
+				return false
+			}
+		}
+		for i := 0; i < u.NumExplicitMethods(); i++ {
+			if !spellable(u.ExplicitMethod(i).Type(), pkg, seen) {
+				return false
+			}
+		}
+	}
+	return true
+}
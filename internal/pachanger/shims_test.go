@@ -0,0 +1,65 @@
+package pachanger_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaveShims(t *testing.T) {
+	t.Run("移動元に互換用の宣言を残す場合", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"model/user.go": "package model\n\nconst MaxUsers = 10\n\nvar DefaultName = \"anon\"\n\ntype User struct{ Name string }\n\nfunc NewUser(name string) *User { return &User{Name: name} }\n",
+			"model/base.go": "package model\n\ntype Base struct{}\n",
+		})
+		target := filepath.Join(workDir, "model/user.go")
+		output := filepath.Join(workDir, "model/user/user.go")
+
+		transformer, err := pachanger.NewTransformer(workDir, "user", "", "", nil)
+		assert.NoError(t, err)
+		transformer.SetLeaveShims(true)
+		assert.NoError(t, transformer.TransformSymbolsInTargetFile(target, output))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(output), 0755))
+		assert.NoError(t, transformer.Dump())
+		assert.NoError(t, os.Remove(target))
+
+		written, err := transformer.WriteShims()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{target}, written)
+
+		got, err := os.ReadFile(target)
+		assert.NoError(t, err)
+		assert.Equal(t, `package model
+
+import "example.com/mod/model/user"
+
+// Deprecated: use user.MaxUsers
+const MaxUsers = user.MaxUsers
+
+// Deprecated: use user.NewUser
+func NewUser(p0 string) *User {
+	return user.NewUser(p0)
+}
+
+// Deprecated: use user.User
+type User = user.User
+`, string(got))
+		// 変数は転送できないため報告する
+		assert.Equal(t, []pachanger.SkippedReference{{File: target, Line: 5, Column: 5, Symbol: "example.com/mod/model.DefaultName"}}, transformer.UnshimmedVars())
+	})
+
+	t.Run("循環参照になる場合", func(t *testing.T) {
+		workDir := writeModule(t, map[string]string{
+			"model/user.go": "package model\n\ntype User struct{ B Base }\n",
+			"model/base.go": "package model\n\ntype Base struct{}\n",
+		})
+		transformer, err := pachanger.NewTransformer(workDir, "user", "", "", nil)
+		assert.NoError(t, err)
+		transformer.SetLeaveShims(true)
+		err = transformer.TransformSymbolsInTargetFile(filepath.Join(workDir, "model/user.go"), filepath.Join(workDir, "model/user/user.go"))
+		assert.ErrorContains(t, err, "import cycle")
+	})
+}
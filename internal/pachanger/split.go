@@ -0,0 +1,257 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// SplitMapping はファイル名のパターンと移動先ディレクトリの対応
+type SplitMapping struct {
+	Pattern string
+	Dir     string
+}
+
+// SplitGroup は同じパッケージへ移動するファイルの集合
+type SplitGroup struct {
+	Dir     string
+	PkgName string
+	Files   []string
+}
+
+// ParseSplitMapping は 'user*.go=internal/model/user' 形式の指定を解析する
+// 移動先ディレクトリが相対パスの場合は absWorkDir を起点とする
+func ParseSplitMapping(absWorkDir, s string) (SplitMapping, error) {
+	pattern, dir, ok := strings.Cut(s, "=")
+	pattern = strings.TrimSpace(pattern)
+	dir = strings.TrimSpace(dir)
+	if !ok || pattern == "" || dir == "" {
+		return SplitMapping{}, fmt.Errorf("invalid mapping %q: expected 'pattern=dir'", s)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return SplitMapping{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(absWorkDir, dir)
+	}
+	return SplitMapping{Pattern: pattern, Dir: filepath.Clean(dir)}, nil
+}
+
+// packageNameForDir はディレクトリ名からパッケージ名を決める
+func packageNameForDir(dir string) string {
+	return strings.ReplaceAll(filepath.Base(dir), "-", "_")
+}
+
+// findPackageByDir は dir にあるパッケージを返す
+// テストを含むバリアントがある場合は、内部テストファイルも含むそちらを優先する
+func findPackageByDir(fs *token.FileSet, pkgs []*packages.Package, dir string) *packages.Package {
+	var found *packages.Package
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.Name, "_test") || len(pkg.Syntax) == 0 {
+			continue
+		}
+		if filepath.Dir(fs.Position(pkg.Syntax[0].Pos()).Filename) != dir {
+			continue
+		}
+		if found == nil || len(pkg.Syntax) > len(found.Syntax) {
+			found = pkg
+		}
+	}
+	return found
+}
+
+// PlanSplit は pkgDir のパッケージを mappings に従って分割する計画を立てる
+// 分割後のパッケージ間で循環参照になる場合や、パッケージをまたいで
+// 非公開のシンボルを参照している場合はエラーを返す
+func PlanSplit(workDir, pkgDir string, mappings []SplitMapping, buildFlags []string) ([]SplitGroup, error) {
+	fs := token.NewFileSet()
+	pkgs, err := loadPackages(fs, workDir, buildFlags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	pkg := findPackageByDir(fs, pkgs, pkgDir)
+	if pkg == nil {
+		return nil, fmt.Errorf("package not found in %s", pkgDir)
+	}
+
+	// ファイルごとの移動先(空文字は元のパッケージに残る)
+	fileGroup := map[string]string{}
+	for _, file := range pkg.Syntax {
+		filename := fs.Position(file.Pos()).Filename
+		fileGroup[filename] = ""
+		for _, m := range mappings {
+			if ok, _ := filepath.Match(m.Pattern, filepath.Base(filename)); ok {
+				if m.Dir == pkgDir {
+					return nil, fmt.Errorf("mapping %s points to the package itself", m.Pattern)
+				}
+				fileGroup[filename] = m.Dir
+				break
+			}
+		}
+	}
+
+	groupName := func(dir string) string {
+		if dir == "" {
+			return pkg.PkgPath
+		}
+		return packageNameForDir(dir)
+	}
+
+	var problems []string
+	edges := map[string]map[string]bool{}
+	for _, file := range pkg.Syntax {
+		from := fileGroup[fs.Position(file.Pos()).Filename]
+		ast.Inspect(file, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj := pkg.TypesInfo.Uses[ident]
+			if obj == nil || obj.Pkg() != pkg.Types {
+				return true
+			}
+			to, ok := fileGroup[fs.Position(obj.Pos()).Filename]
+			if !ok || to == from {
+				return true
+			}
+			if !obj.Exported() {
+				problems = append(problems, fmt.Sprintf("%s: unexported %s is used across %s and %s", fs.Position(ident.Pos()), obj.Name(), groupName(from), groupName(to)))
+				return true
+			}
+			if edges[from] == nil {
+				edges[from] = map[string]bool{}
+			}
+			edges[from][to] = true
+			return true
+		})
+	}
+
+	// メソッドはレシーバの型と同じパッケージに置く必要がある
+	for ident, obj := range pkg.TypesInfo.Defs {
+		fn, ok := obj.(*types.Func)
+		if !ok {
+			continue
+		}
+		recv := fn.Type().(*types.Signature).Recv()
+		if recv == nil {
+			continue
+		}
+		named := namedOf(recv.Type())
+		if named == nil {
+			continue
+		}
+		methodGroup, ok := fileGroup[fs.Position(ident.Pos()).Filename]
+		if !ok {
+			continue
+		}
+		if typeGroup, ok := fileGroup[fs.Position(named.Obj().Pos()).Filename]; ok && typeGroup != methodGroup {
+			problems = append(problems, fmt.Sprintf("%s: method %s.%s must move with its receiver type", fs.Position(ident.Pos()), named.Obj().Name(), fn.Name()))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("cannot split %s:\n%s", pkg.PkgPath, strings.Join(problems, "\n"))
+	}
+
+	if cycle := findCycle(edges); cycle != nil {
+		names := make([]string, len(cycle))
+		for i, g := range cycle {
+			names[i] = groupName(g)
+		}
+		return nil, fmt.Errorf("cannot split %s: import cycle %s", pkg.PkgPath, strings.Join(names, " -> "))
+	}
+
+	groups := map[string]*SplitGroup{}
+	for file, dir := range fileGroup {
+		if dir == "" {
+			continue
+		}
+		g, ok := groups[dir]
+		if !ok {
+			g = &SplitGroup{Dir: dir, PkgName: packageNameForDir(dir)}
+			groups[dir] = g
+		}
+		g.Files = append(g.Files, file)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no files in %s matched the mappings", pkgDir)
+	}
+
+	var result []SplitGroup
+	for _, g := range groups {
+		sort.Strings(g.Files)
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Dir < result[j].Dir
+	})
+	return result, nil
+}
+
+// namedOf はポインタを外した名前付き型を返す
+func namedOf(t types.Type) *types.Named {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, _ := t.(*types.Named)
+	return named
+}
+
+// findCycle はグラフに循環があればその経路を返す
+func findCycle(edges map[string]map[string]bool) []string {
+	nodes := make([]string, 0, len(edges))
+	for n := range edges {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var stack []string
+	var visit func(n string) []string
+	visit = func(n string) []string {
+		state[n] = visiting
+		stack = append(stack, n)
+		next := make([]string, 0, len(edges[n]))
+		for m := range edges[n] {
+			next = append(next, m)
+		}
+		sort.Strings(next)
+		for _, m := range next {
+			switch state[m] {
+			case visiting:
+				for i, s := range stack {
+					if s == m {
+						return append(append([]string{}, stack[i:]...), m)
+					}
+				}
+			case unvisited:
+				if cycle := visit(m); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = visited
+		return nil
+	}
+	for _, n := range nodes {
+		if state[n] == unvisited {
+			if cycle := visit(n); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
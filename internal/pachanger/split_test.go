@@ -0,0 +1,82 @@
+package pachanger_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	workDir := t.TempDir()
+	files["go.mod"] = "module example.com/mod\n\ngo 1.23\n"
+	for name, content := range files {
+		p := filepath.Join(workDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	return workDir
+}
+
+func TestPlanSplit(t *testing.T) {
+	files := map[string]string{
+		"model/user.go":  "package model\n\ntype User struct {\n\tOrders []Order\n}\n",
+		"model/order.go": "package model\n\ntype Order struct {\n\tID int\n}\n",
+		"model/base.go":  "package model\n\nconst Version = 1\n",
+	}
+
+	t.Run("分割できる場合", func(t *testing.T) {
+		workDir := writeModule(t, files)
+		mappings := []pachanger.SplitMapping{}
+		for _, m := range []string{"user*.go=model/user", "order*.go=model/order"} {
+			mapping, err := pachanger.ParseSplitMapping(workDir, m)
+			assert.NoError(t, err)
+			mappings = append(mappings, mapping)
+		}
+
+		groups, err := pachanger.PlanSplit(workDir, filepath.Join(workDir, "model"), mappings, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []pachanger.SplitGroup{
+			{Dir: filepath.Join(workDir, "model/order"), PkgName: "order", Files: []string{filepath.Join(workDir, "model/order.go")}},
+			{Dir: filepath.Join(workDir, "model/user"), PkgName: "user", Files: []string{filepath.Join(workDir, "model/user.go")}},
+		}, groups)
+	})
+
+	t.Run("循環参照になる場合", func(t *testing.T) {
+		cyclic := map[string]string{}
+		for k, v := range files {
+			cyclic[k] = v
+		}
+		cyclic["model/order.go"] += "\nfunc (o Order) Owner() *User { return nil }\n"
+		workDir := writeModule(t, cyclic)
+
+		mappings := []pachanger.SplitMapping{
+			{Pattern: "user*.go", Dir: filepath.Join(workDir, "model/user")},
+			{Pattern: "order*.go", Dir: filepath.Join(workDir, "model/order")},
+		}
+		_, err := pachanger.PlanSplit(workDir, filepath.Join(workDir, "model"), mappings, nil)
+		assert.ErrorContains(t, err, "import cycle order -> user -> order")
+	})
+
+	t.Run("非公開のシンボルを参照している場合", func(t *testing.T) {
+		unexported := map[string]string{}
+		for k, v := range files {
+			unexported[k] = v
+		}
+		unexported["model/base.go"] += "\nfunc helper() {}\n"
+		unexported["model/user.go"] += "\nfunc init() { helper() }\n"
+		workDir := writeModule(t, unexported)
+
+		mappings := []pachanger.SplitMapping{
+			{Pattern: "user*.go", Dir: filepath.Join(workDir, "model/user")},
+		}
+		_, err := pachanger.PlanSplit(workDir, filepath.Join(workDir, "model"), mappings, nil)
+		assert.ErrorContains(t, err, "unexported helper is used across user and example.com/mod/model")
+	})
+
+	_, err := pachanger.ParseSplitMapping("/tmp", "user*.go")
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StringRefMode は移動したシンボルの名前と同じ文字列リテラルの扱い
+type StringRefMode string
+
+const (
+	// StringRefOff は文字列リテラルを調べない
+	StringRefOff StringRefMode = "off"
+	// StringRefReport は文字列リテラルを書き換えず、位置を報告する
+	StringRefReport StringRefMode = "report"
+	// StringRefRewrite は文字列リテラルを移動先の名前に書き換え、位置を報告する
+	StringRefRewrite StringRefMode = "rewrite"
+)
+
+// ParseStringRefMode は --string-refs フラグの値を解析する
+func ParseStringRefMode(s string) (StringRefMode, error) {
+	switch mode := StringRefMode(s); mode {
+	case StringRefOff, StringRefReport, StringRefRewrite:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown string reference mode %q: must be one of off, report, rewrite", s)
+}
+
+// SetStringRefMode は文字列リテラルの扱いを変更する
+func (t *Transformer) SetStringRefMode(mode StringRefMode) {
+	t.stringRefMode = mode
+}
+
+// StringReference は移動したシンボルを "oldpkg.Foo" や "example.com/mod/oldpkg.Foo" の形で書いた文字列リテラル
+// reflect.TypeOf の名前や %T の期待値、型の登録などで使われ、移動すると実行時に壊れる
+type StringReference struct {
+	File   string
+	Line   int
+	Column int
+	Value  string
+	// 移動後の名前
+	Replacement string
+	Rewritten   bool
+}
+
+func (r StringReference) String() string {
+	return fmt.Sprintf("%s:%d:%d: %q -> %q", r.File, r.Line, r.Column, r.Value, r.Replacement)
+}
+
+// StringReferences は見つかった文字列リテラルの一覧を返す
+func (t *Transformer) StringReferences() []StringReference {
+	t.skippedMutex.Lock()
+	defer t.skippedMutex.Unlock()
+	refs := slices.Clone(t.stringRefs)
+	slices.SortFunc(refs, func(a, b StringReference) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return refs
+}
+
+// rewriteStringReferences はファイル中の移動したシンボルの名前と同じ文字列リテラルを記録し、指定があれば書き換える
+// "*oldpkg.Foo" や "[]oldpkg.Foo" のように %T が付ける接頭辞は許す
+func (t *Transformer) rewriteStringReferences(filename string, file *ast.File) bool {
+	if t.stringRefMode == "" || t.stringRefMode == StringRefOff {
+		return false
+	}
+	modified := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		value, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		replacement, ok := t.movedStringName(value)
+		if !ok {
+			return true
+		}
+
+		pos := t.fs.Position(lit.Pos())
+		ref := StringReference{
+			File:        filename,
+			Line:        pos.Line,
+			Column:      pos.Column,
+			Value:       value,
+			Replacement: replacement,
+			Rewritten:   t.stringRefMode == StringRefRewrite,
+		}
+		if ref.Rewritten {
+			if strings.HasPrefix(lit.Value, "`") && !strings.Contains(replacement, "`") {
+				lit.Value = "`" + replacement + "`"
+			} else {
+				lit.Value = strconv.Quote(replacement)
+			}
+			modified = true
+		}
+		debugf("Found string reference %s", ref)
+		t.skippedMutex.Lock()
+		t.stringRefs = append(t.stringRefs, ref)
+		t.skippedMutex.Unlock()
+		return true
+	})
+	return modified
+}
+
+// movedStringName は value が移動したシンボルの修飾名か import path 付きの名前なら、移動後の名前を返す
+func (t *Transformer) movedStringName(value string) (string, bool) {
+	name := strings.TrimLeft(value, "*[]")
+	prefix := value[:len(value)-len(name)]
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return "", false
+	}
+	qualifier, sym := name[:dot], name[dot+1:]
+	if !t.targetSymbols[sym] {
+		return "", false
+	}
+
+	var replaced string
+	switch qualifier {
+	case t.oldPkg:
+		replaced = t.newPkg + "." + t.transformSymbolName(sym)
+	case t.oldPkgPath:
+		replaced = t.newPkgPath + "." + t.transformSymbolName(sym)
+	default:
+		return "", false
+	}
+	if replaced == name {
+		return "", false
+	}
+	return prefix + replaced, true
+}
@@ -0,0 +1,61 @@
+package pachanger_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pyama86/pachanger/internal/pachanger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringReferences(t *testing.T) {
+	files := map[string]string{
+		"model/user.go": "package model\n\ntype User struct{ Name string }\n",
+		"model/base.go": "package model\n\ntype Base struct{}\n\nvar registry = map[string]any{\"model.User\": User{}, \"model.Base\": Base{}}\n",
+		"app/app_test.go": "package app\n\nimport (\n\t\"fmt\"\n\t\"testing\"\n\n\t\"example.com/mod/model\"\n)\n\n" +
+			"func TestType(t *testing.T) {\n" +
+			"\tif fmt.Sprintf(\"%T\", &model.User{}) != \"*model.User\" {\n\t\tt.Fatal()\n\t}\n" +
+			"\t_ = `*example.com/mod/model.User`\n" +
+			"\t_ = \"other.User\"\n" +
+			"}\n",
+	}
+
+	transform := func(t *testing.T, mode pachanger.StringRefMode) (string, *pachanger.Transformer, func(string) string) {
+		cfg := moveConfig{setup: func(transformer *pachanger.Transformer) { transformer.SetStringRefMode(mode) }}
+		return moveAndRead(t, files, cfg, "model/user.go", "model/user/user.go", "model/base.go", "app/app_test.go")
+	}
+
+	t.Run("報告のみの場合", func(t *testing.T) {
+		workDir, transformer, read := transform(t, pachanger.StringRefReport)
+		assert.Contains(t, read("app/app_test.go"), "!= \"*model.User\"")
+		refs := transformer.StringReferences()
+		if assert.Len(t, refs, 3) {
+			assert.Equal(t, pachanger.StringReference{
+				File: filepath.Join(workDir, "app/app_test.go"), Line: 11, Column: 41,
+				Value: "*model.User", Replacement: "*user.User",
+			}, refs[0])
+			assert.Equal(t, "*example.com/mod/model/user.User", refs[1].Replacement)
+			assert.Equal(t, filepath.Join(workDir, "model/base.go"), refs[2].File)
+		}
+	})
+
+	t.Run("書き換える場合", func(t *testing.T) {
+		_, transformer, read := transform(t, pachanger.StringRefRewrite)
+		app := read("app/app_test.go")
+		assert.Contains(t, app, "!= \"*user.User\"")
+		assert.Contains(t, app, "_ = `*example.com/mod/model/user.User`\n")
+		assert.Contains(t, app, "_ = \"other.User\"\n")
+		base := read("model/base.go")
+		assert.Contains(t, base, "\"user.User\": user.User{}")
+		assert.Contains(t, base, "\"model.Base\": Base{}")
+		for _, ref := range transformer.StringReferences() {
+			assert.True(t, ref.Rewritten)
+		}
+	})
+
+	t.Run("調べない場合", func(t *testing.T) {
+		_, transformer, read := transform(t, pachanger.StringRefOff)
+		assert.Contains(t, read("app/app_test.go"), "!= \"*model.User\"")
+		assert.Empty(t, transformer.StringReferences())
+	})
+}
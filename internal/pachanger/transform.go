@@ -73,6 +73,46 @@ type Transformer struct {
 	aliasMutex    sync.Mutex
 	// エイリアス情報を格納するマップ（ファイル別）
 	aliasMap map[string]map[string]string // ファイル名 -> (エイリアス名 -> 実際のパッケージパス)
+	// 書き換え対象を限定する場合のファイル一覧(nilなら全ファイルが対象)
+	fileFilter   map[string]bool
+	skippedRefs  []SkippedReference
+	skippedMutex sync.Mutex
+	journal      *Journal
+	// 移動元のパッケージに互換用の宣言を残すか
+	leaveShims    bool
+	shims         []shimTarget
+	unshimmedVars []SkippedReference
+	// コメント中の "oldpkg.Foo" のような記述も書き換えるか
+	rewriteMentions bool
+	// ドットimportで参照している移動したシンボルの書き換え方
+	dotImportMode DotImportMode
+	// ターゲットファイルが init 関数を宣言しているか
+	movesInit bool
+	// 処理中のターゲットファイルと出力先、ターゲットファイルで宣言された非公開のものも含むシンボル
+	targetFile        string
+	outputFile        string
+	targetDecls       map[string]bool
+	directiveWarnings []DirectiveWarning
+	// 生成されたファイルの扱いと、移動したシンボルを参照している生成されたファイル
+	generatedPolicy GeneratedPolicy
+	generatedFiles  map[string]*GeneratedFile
+	// インターフェースと同じパッケージのモックも移動するか
+	moveMocks bool
+	// 移動したシンボルの名前と同じ文字列リテラルの扱いと、見つかったもの
+	stringRefMode StringRefMode
+	stringRefs    []StringReference
+}
+
+// SkippedReference は書き換え対象外としたファイルに残った、移動したシンボルへの参照
+type SkippedReference struct {
+	File   string
+	Line   int
+	Column int
+	Symbol string
+}
+
+func (r SkippedReference) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", r.File, r.Line, r.Column, r.Symbol)
 }
 
 // NewTransformer は Transformer を生成
@@ -83,21 +123,52 @@ func NewTransformer(workDir, newPkg, addPrefix, deletePrefix string, buildFlags
 	if err != nil {
 		return nil, fmt.Errorf("failed to load packages: %w", err)
 	}
+	// 既定の設定では除外される GOOS/GOARCH やタグ付きのファイルも書き換えられるよう、別の設定でも読み込む
+	variantPkgs, err := loadBuildVariants(fs, workDir, buildFlags, allPkgs)
+	if err != nil {
+		return nil, err
+	}
+	allPkgs = append(allPkgs, variantPkgs...)
 
 	slog.Info("Loaded packages", slog.Int("count", len(allPkgs)))
 	return &Transformer{
-		fs:           fs,
-		addPrefix:    addPrefix,
-		deletePrefix: deletePrefix,
-		workDir:      workDir,
-		newPkg:       newPkg,
-		doneIdent:    map[*ast.Ident]bool{},
-		doneFile:     map[string]*astWithOutFile{},
-		allPkgs:      allPkgs,
-		aliasMap:     map[string]map[string]string{},
+		fs:              fs,
+		addPrefix:       addPrefix,
+		deletePrefix:    deletePrefix,
+		workDir:         workDir,
+		newPkg:          newPkg,
+		doneIdent:       map[*ast.Ident]bool{},
+		doneFile:        map[string]*astWithOutFile{},
+		allPkgs:         allPkgs,
+		aliasMap:        map[string]map[string]string{},
+		dotImportMode:   DotImportKeep,
+		generatedPolicy: GeneratedRewrite,
 	}, nil
 }
 
+// SetFileFilter は TransformSymbolsInOtherFile で書き換えるファイルを files に限定する
+// 対象外のファイルに残った参照は SkippedReferences で取得できる
+func (t *Transformer) SetFileFilter(files []string) {
+	t.fileFilter = map[string]bool{}
+	for _, f := range files {
+		t.fileFilter[f] = true
+	}
+}
+
+// SetJournal は書き換えるファイルの変更前の内容を journal に記録するようにする
+func (t *Transformer) SetJournal(journal *Journal) {
+	t.journal = journal
+}
+
+// SkippedReferences は書き換え対象外としたために壊れる参照の一覧を返す
+func (t *Transformer) SkippedReferences() []SkippedReference {
+	t.skippedMutex.Lock()
+	defer t.skippedMutex.Unlock()
+	refs := make([]SkippedReference, len(t.skippedRefs))
+	copy(refs, t.skippedRefs)
+	return refs
+}
+
 func (t *Transformer) getDoneFile(key string) *astWithOutFile {
 	t.fileMutex.Lock()
 	defer t.fileMutex.Unlock()
@@ -159,7 +230,12 @@ func loadPackages(fs *token.FileSet, absWorkDir string, buildFlags []string) ([]
 		Tests:      true,
 		BuildFlags: buildFlags,
 	}
-	return packages.Load(cfg, "./...")
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, err
+	}
+	reparseCgoPackages(fs, pkgs)
+	return pkgs, nil
 }
 
 func (t *Transformer) findPackageForFile(absTargetFile string) (*ast.File, *packages.Package, error) {
@@ -204,6 +280,9 @@ func (t *Transformer) Dump() error {
 				if v.oldPkgPath != "" && !astutil.UsesImport(v.node, v.oldPkgPath) {
 					t.addImport(v.node, v.oldPkgName, v.oldPkgPath)
 				}
+				if err := t.journal.RecordFile(v.output); err != nil {
+					return err
+				}
 				if err := writeFile(t.fs, v.node, v.output); err != nil {
 					return err
 				}
@@ -267,6 +346,9 @@ func (t *Transformer) TransformSymbolsInTargetFile(target, output string) error
 	t.oldPkg = node.Name.Name
 	t.oldPkgPath = pkg.PkgPath
 	t.targetSymbols, t.otherSymbols = t.filterDefSymbols(pkg, target)
+	t.movesInit = declaresInit(node)
+	t.targetFile, t.outputFile = target, output
+	t.targetDecls = t.declaredNames(pkg, target)
 	if len(t.targetSymbols) == 0 && len(t.otherSymbols) == 0 {
 		return fmt.Errorf("no symbols found in target file: %s target:%d other:%d may be having syntax errors", target, len(t.targetSymbols), len(t.otherSymbols))
 	}
@@ -286,9 +368,23 @@ func (t *Transformer) TransformSymbolsInTargetFile(target, output string) error
 	}
 	t.newPkgPath = path.Join(gomod.Module.Mod.Path, outputDir[len(goDir):])
 
+	if err := t.prepareCgoMove(target, output, node); err != nil {
+		return err
+	}
+
+	if t.leaveShims {
+		goVersion := ""
+		if gomod.Go != nil {
+			goVersion = gomod.Go.Version
+		}
+		if err := t.recordShims(target, output, goVersion, pkg); err != nil {
+			return err
+		}
+	}
+
 	debugf("load target symbol oldPkg: %s, newPkg: %s, oldPkgPath: %s, newPkgPath: %s", t.oldPkg, t.newPkg, t.oldPkgPath, t.newPkgPath)
 
-	modified, err := t.transformFile(target, node, pkg.TypesInfo, true)
+	modified, err := t.transformFile(target, node, pkg.PkgPath, pkg.TypesInfo, true)
 	if err != nil {
 		return err
 	}
@@ -322,10 +418,33 @@ func (t *Transformer) TransformSymbolsInOtherFile(target, output string) error {
 		return fmt.Errorf("failed to find package for file: %w", err)
 	}
 
-	modified, err := t.transformFile(target, node, pkg.TypesInfo, false)
+	// 移動済みのファイルはフィルタに関わらず必ず書き換える
+	if t.fileFilter != nil && !t.fileFilter[target] && t.getDoneFile(target) == nil {
+		t.collectSkippedReferences(target, node, pkg.TypesInfo)
+		return nil
+	}
+
+	// 生成されたファイルは、移動済みのものを除いて指定された扱いにする
+	_, moved := t.movedPath(target)
+	generated := ast.IsGenerated(node) && !moved
+	if generated && t.generatedPolicy == GeneratedSkip {
+		if refs := t.movedReferences(target, node, pkg.TypesInfo); len(refs) > 0 {
+			t.recordGenerated(target, node, false, refs)
+		}
+		return nil
+	}
+
+	// ドットimportやブランクimportは名前での書き換えより先に型情報で処理する
+	importModified := t.rewriteImportedUses(node, pkg.PkgPath, pkg.TypesInfo)
+
+	modified, err := t.transformFile(target, node, pkg.PkgPath, pkg.TypesInfo, false)
 	if err != nil {
 		return err
 	}
+	modified = modified || importModified
+	if generated && modified {
+		t.recordGenerated(target, node, true, nil)
+	}
 
 	if modified {
 		debugf("modified file: %s", output)
@@ -343,6 +462,44 @@ func (t *Transformer) TransformSymbolsInOtherFile(target, output string) error {
 	return nil
 }
 
+// collectSkippedReferences は書き換えないファイルに残る、移動対象シンボルへの参照を記録する
+func (t *Transformer) collectSkippedReferences(target string, file *ast.File, typesInfo *types.Info) {
+	refs := t.movedReferences(target, file, typesInfo)
+	if len(refs) == 0 {
+		return
+	}
+	t.skippedMutex.Lock()
+	defer t.skippedMutex.Unlock()
+	t.skippedRefs = append(t.skippedRefs, refs...)
+}
+
+// movedReferences はファイルに含まれる、移動対象シンボルへの参照を返す
+func (t *Transformer) movedReferences(target string, file *ast.File, typesInfo *types.Info) []SkippedReference {
+	var refs []SkippedReference
+	ast.Inspect(file, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := typesInfo.Uses[ident]
+		if obj == nil || obj.Pkg() == nil || obj.Pkg().Path() != t.oldPkgPath || obj.Parent() != obj.Pkg().Scope() {
+			return true
+		}
+		if !t.targetSymbols[obj.Name()] {
+			return true
+		}
+		pos := t.fs.Position(ident.Pos())
+		refs = append(refs, SkippedReference{
+			File:   target,
+			Line:   pos.Line,
+			Column: pos.Column,
+			Symbol: fmt.Sprintf("%s.%s", t.oldPkg, obj.Name()),
+		})
+		return true
+	})
+	return refs
+}
+
 // collectAliases はファイル内のimport文からエイリアス情報を収集する
 func (t *Transformer) collectAliases(filename string, file *ast.File) {
 	t.aliasMutex.Lock()
@@ -353,7 +510,8 @@ func (t *Transformer) collectAliases(filename string, file *ast.File) {
 	}
 
 	for _, imp := range file.Imports {
-		if imp.Name != nil {
+		// ドットimportとブランクimportはエイリアスではない
+		if imp.Name != nil && imp.Name.Name != "." && imp.Name.Name != "_" {
 			// エイリアス付きimport
 			alias := imp.Name.Name
 			path := strings.Trim(imp.Path.Value, "\"")
@@ -376,7 +534,7 @@ func (t *Transformer) isAliasForOldPackage(filename, alias string) bool {
 	return false
 }
 
-func (t *Transformer) transformFile(target string, file *ast.File, typesInfo *types.Info, isTarget bool) (bool, error) {
+func (t *Transformer) transformFile(target string, file *ast.File, pkgPath string, typesInfo *types.Info, isTarget bool) (bool, error) {
 	// エイリアス情報を収集
 	t.collectAliases(target, file)
 
@@ -398,6 +556,20 @@ func (t *Transformer) transformFile(target string, file *ast.File, typesInfo *ty
 		return true
 	})
 
+	// コード中の参照を書き換えた後に、コメント中のドキュメントリンクを書き換える
+	if t.rewriteComments(file, pkgPath, typesInfo, isTarget) {
+		modified = true
+	}
+	if t.rewriteDirectives(target, file, isTarget) {
+		modified = true
+	}
+	if ast.IsGenerated(file) && t.rewriteMockHeader(target, file, isTarget) {
+		modified = true
+	}
+	if t.rewriteStringReferences(target, file) {
+		modified = true
+	}
+
 	return modified, nil
 }
 func (t *Transformer) addDoneList(e *ast.Ident) {
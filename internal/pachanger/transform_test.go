@@ -30,9 +30,7 @@ func init() {
 }
 
 func TestTransformTargetFile(t *testing.T) {
-	workDir, err := os.Getwd()
-	assert.NoError(t, err)
-	workDir = filepath.Join(workDir, "testdata")
+	workDir := copyTestdata(t)
 
 	inputPath := filepath.Join(workDir, "example/target_ok.go")
 	expectedPath := filepath.Join(workDir, "expected/target_ok.go")
@@ -54,9 +52,7 @@ func TestTransformTargetFile(t *testing.T) {
 }
 
 func TestTransformGenericType(t *testing.T) {
-	workDir, err := os.Getwd()
-	assert.NoError(t, err)
-	workDir = filepath.Join(workDir, "testdata")
+	workDir := copyTestdata(t)
 
 	inputPath := filepath.Join(workDir, "example/generic_test.go")
 	expectedPath := filepath.Join(workDir, "expected/generic_test.go")
@@ -78,9 +74,7 @@ func TestTransformGenericType(t *testing.T) {
 }
 
 func TestTransformOtherFile(t *testing.T) {
-	workDir, err := os.Getwd()
-	assert.NoError(t, err)
-	workDir = filepath.Join(workDir, "testdata")
+	workDir := copyTestdata(t)
 
 	targetPath := filepath.Join(workDir, "example/target_ok.go")
 	targetOutputPath := filepath.Join(workDir, "output/changed_example/target_ok.go")
@@ -196,6 +190,38 @@ func TestTransformOtherFile(t *testing.T) {
 	})
 }
 
+func TestTransformWithFileFilter(t *testing.T) {
+	workDir := copyTestdata(t)
+
+	targetPath := filepath.Join(workDir, "example/target_ok.go")
+	targetOutputPath := filepath.Join(workDir, "output/changed_example/target_ok.go")
+	inputPath := filepath.Join(workDir, "someother/other_package_ok.go")
+	outputPath := filepath.Join(workDir, "output/someother/other_package_ok.go")
+	_ = os.Remove(outputPath)
+
+	transformer, err := pachanger.NewTransformer(workDir, "changed_example", "", "", nil)
+	assert.NoError(t, err)
+	transformer.SetFileFilter([]string{})
+
+	err = transformer.TransformSymbolsInTargetFile(targetPath, targetOutputPath)
+	assert.NoError(t, err)
+	err = transformer.TransformSymbolsInOtherFile(inputPath, outputPath)
+	assert.NoError(t, err)
+	err = transformer.Dump()
+	assert.NoError(t, err)
+
+	// 対象外のファイルは書き出されない
+	_, err = os.Stat(outputPath)
+	assert.True(t, os.IsNotExist(err))
+
+	refs := transformer.SkippedReferences()
+	assert.NotEmpty(t, refs)
+	for _, ref := range refs {
+		assert.Equal(t, inputPath, ref.File)
+	}
+	assert.Contains(t, refs, pachanger.SkippedReference{File: inputPath, Line: 18, Column: 24, Symbol: "example.Example"})
+}
+
 func compareFiles(fileA, fileB string) (string, error) {
 	a, err := os.ReadFile(fileA)
 	if err != nil {
@@ -229,3 +255,67 @@ func compareFiles(fileA, fileB string) (string, error) {
 	}
 	return strings.Join(diffs, "\n"), nil
 }
+
+// copyTestdata は testdata のモジュールを一時ディレクトリに複製する
+// テストが書き出すファイルをリポジトリに残さないため、複製したモジュールで変換する
+func copyTestdata(t *testing.T) string {
+	t.Helper()
+	workDir := filepath.Join(t.TempDir(), "testdata")
+	assert.NoError(t, os.CopyFS(workDir, os.DirFS("testdata")))
+	return workDir
+}
+
+// moveConfig は moveAndRead で作る Transformer の設定
+type moveConfig struct {
+	addPrefix string
+	// 変換を始める前に Transformer を設定する
+	setup func(*pachanger.Transformer)
+}
+
+// moveAndRead は files を書き出したモジュールで target を output へ移動し、others の参照を書き換える
+// パスは workDir からの相対パスで、移動先のパッケージ名は output のディレクトリ名にする
+// 一緒に移動するモックも含めて cmd と同じ順番で変換し、変換後のファイルを読む関数を返す
+func moveAndRead(t *testing.T, files map[string]string, cfg moveConfig, target, output string, others ...string) (string, *pachanger.Transformer, func(name string) string) {
+	t.Helper()
+	workDir := writeModule(t, files)
+	abs := func(name string) string { return filepath.Join(workDir, name) }
+	transformer, err := pachanger.NewTransformer(workDir, filepath.Base(filepath.Dir(output)), cfg.addPrefix, "", nil)
+	assert.NoError(t, err)
+	if cfg.setup != nil {
+		cfg.setup(transformer)
+	}
+
+	targets := []string{abs(target)}
+	outputs := map[string]string{abs(target): abs(output)}
+	mocks, err := transformer.FindMocks(outputs)
+	assert.NoError(t, err)
+	for _, mock := range mocks {
+		if mock.Output != "" {
+			targets = append(targets, mock.Path)
+			outputs[mock.Path] = mock.Output
+		}
+	}
+
+	for _, target := range targets {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(outputs[target]), 0755))
+		assert.NoError(t, transformer.TransformSymbolsInTargetFile(target, outputs[target]))
+		for original, moved := range transformer.MovedFiles() {
+			if original != target {
+				assert.NoError(t, transformer.TransformSymbolsInOtherFile(original, moved))
+			}
+		}
+		for _, f := range others {
+			if abs(f) != target && abs(f) != outputs[target] {
+				assert.NoError(t, transformer.TransformSymbolsInOtherFile(abs(f), abs(f)))
+			}
+		}
+	}
+	assert.NoError(t, transformer.Dump())
+
+	return workDir, transformer, func(name string) string {
+		t.Helper()
+		b, err := os.ReadFile(abs(name))
+		assert.NoError(t, err)
+		return string(b)
+	}
+}
@@ -0,0 +1,306 @@
+package pachanger
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// knownOS と knownArch は go/build が GOOS と GOARCH として扱う値
+var (
+	knownOS = []string{
+		"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "js", "linux",
+		"nacl", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows", "zos",
+	}
+	unixOS = []string{
+		"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "linux",
+		"netbsd", "openbsd", "solaris",
+	}
+	knownArch = []string{
+		"386", "amd64", "amd64p32", "arm", "armbe", "arm64", "arm64be", "loong64", "mips", "mipsle",
+		"mips64", "mips64le", "mips64p32", "mips64p32le", "ppc", "ppc64", "ppc64le", "riscv", "riscv64",
+		"s390", "s390x", "sparc", "sparc64", "wasm",
+	}
+)
+
+// buildVariant は既定の設定ではビルドから除外されるファイルを読み込むための設定
+type buildVariant struct {
+	goos   string
+	goarch string
+	tags   []string
+}
+
+func (v buildVariant) key() string {
+	return fmt.Sprintf("%s/%s/%s", v.goos, v.goarch, strings.Join(v.tags, ","))
+}
+
+// loadBuildVariants は既定の設定で読み込んだ pkgs から除外されたファイルを調べ、
+// それらを含められる GOOS/GOARCH/タグの組み合わせごとに読み込んだパッケージを返す
+// 同じファイルは既定の設定で読み込んだものが優先されるよう、呼び出し元で pkgs の後ろに追加する
+func loadBuildVariants(fs *token.FileSet, absWorkDir string, buildFlags []string, pkgs []*packages.Package) ([]*packages.Package, error) {
+	loaded := map[string]bool{}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.CompiledGoFiles {
+			loaded[f] = true
+		}
+		for _, f := range pkg.GoFiles {
+			loaded[f] = true
+		}
+	}
+
+	baseTags := buildTags(buildFlags)
+	variants := map[string]buildVariant{}
+	files := map[string][]string{}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.IgnoredFiles {
+			if !strings.HasSuffix(f, ".go") || loaded[f] {
+				continue
+			}
+			loaded[f] = true
+			variant, ok := variantFor(f, baseTags)
+			if !ok {
+				debugf("No build variant includes %s", f)
+				continue
+			}
+			variants[variant.key()] = variant
+			files[variant.key()] = append(files[variant.key()], f)
+		}
+	}
+
+	keys := make([]string, 0, len(variants))
+	for key := range variants {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var variantPkgs []*packages.Package
+	for _, key := range keys {
+		variant := variants[key]
+		slog.Info("Loading build variant", slog.String("goos", variant.goos), slog.String("goarch", variant.goarch), slog.String("tags", strings.Join(variant.tags, ",")), slog.Int("files", len(files[key])))
+		flags := withoutTags(buildFlags)
+		if len(variant.tags) > 0 {
+			flags = append(flags, "-tags", strings.Join(variant.tags, ","))
+		}
+		cfg := &packages.Config{
+			Mode:       packages.LoadAllSyntax | packages.NeedForTest,
+			Dir:        absWorkDir,
+			Fset:       fs,
+			Tests:      true,
+			BuildFlags: flags,
+			Env:        append(os.Environ(), "GOOS="+variant.goos, "GOARCH="+variant.goarch),
+		}
+		loadedPkgs, err := packages.Load(cfg, "./...")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load build variant %s: %w", key, err)
+		}
+		reparseCgoPackages(fs, loadedPkgs)
+		// 除外されていたファイルを含むパッケージだけを使う
+		for _, pkg := range loadedPkgs {
+			if slices.ContainsFunc(pkg.CompiledGoFiles, func(f string) bool { return slices.Contains(files[key], f) }) {
+				variantPkgs = append(variantPkgs, pkg)
+			}
+		}
+	}
+	return variantPkgs, nil
+}
+
+// variantFor はファイル名の GOOS/GOARCH と //go:build の制約を満たす設定を探す
+// ホストの GOOS/GOARCH と少ないタグの組み合わせを優先する
+func variantFor(filename string, baseTags []string) (buildVariant, bool) {
+	fileOS, fileArch := osArchFromFileName(filepath.Base(filename))
+	expr, err := buildConstraint(filename)
+	if err != nil {
+		return buildVariant{}, false
+	}
+
+	exprTags := constraintTags(expr, nil)
+
+	candidates := func(fromFile string, known []string, host string, defaults ...string) []string {
+		if fromFile != "" {
+			return []string{fromFile}
+		}
+		list := []string{host}
+		for _, tag := range exprTags {
+			if slices.Contains(known, tag) && !slices.Contains(list, tag) {
+				list = append(list, tag)
+			}
+		}
+		for _, d := range defaults {
+			if !slices.Contains(list, d) {
+				list = append(list, d)
+			}
+		}
+		return list
+	}
+	var custom []string
+	for _, tag := range exprTags {
+		if !slices.Contains(knownOS, tag) && !slices.Contains(knownArch, tag) && !isBuiltinTag(tag) && !slices.Contains(baseTags, tag) {
+			custom = append(custom, tag)
+		}
+	}
+	// タグの組み合わせが多すぎる場合は探索しない
+	if len(custom) > 10 {
+		return buildVariant{}, false
+	}
+	subsets := [][]string{}
+	for mask := 0; mask < 1<<len(custom); mask++ {
+		var subset []string
+		for i, tag := range custom {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, tag)
+			}
+		}
+		subsets = append(subsets, subset)
+	}
+	slices.SortStableFunc(subsets, func(a, b []string) int { return len(a) - len(b) })
+
+	for _, goos := range candidates(fileOS, knownOS, runtime.GOOS) {
+		archs := candidates(fileArch, knownArch, runtime.GOARCH, "amd64", "arm64")
+		if goos == "js" || goos == "wasip1" {
+			archs = []string{"wasm"}
+		}
+		for _, goarch := range archs {
+			if fileArch != "" && goarch != fileArch {
+				continue
+			}
+			for _, subset := range subsets {
+				tags := append(slices.Clone(baseTags), subset...)
+				if expr != nil && !expr.Eval(func(tag string) bool { return matchTag(tag, goos, goarch, tags) }) {
+					continue
+				}
+				if goos == runtime.GOOS && goarch == runtime.GOARCH && len(subset) == 0 {
+					// 既定の設定で満たせるのに除外されている(ignore など)
+					return buildVariant{}, false
+				}
+				slices.Sort(tags)
+				return buildVariant{goos: goos, goarch: goarch, tags: tags}, true
+			}
+		}
+	}
+	return buildVariant{}, false
+}
+
+// constraintTags は制約に含まれるタグを返す
+// Eval は || を短絡評価してすべてのタグを辿らないため、式を直接辿る
+func constraintTags(expr constraint.Expr, tags []string) []string {
+	switch expr := expr.(type) {
+	case *constraint.TagExpr:
+		if !slices.Contains(tags, expr.Tag) {
+			tags = append(tags, expr.Tag)
+		}
+	case *constraint.NotExpr:
+		tags = constraintTags(expr.X, tags)
+	case *constraint.AndExpr:
+		tags = constraintTags(expr.Y, constraintTags(expr.X, tags))
+	case *constraint.OrExpr:
+		tags = constraintTags(expr.Y, constraintTags(expr.X, tags))
+	}
+	return tags
+}
+
+// matchTag は go/build と同様に、ビルドタグが GOOS/GOARCH とタグで満たされるかを返す
+func matchTag(tag, goos, goarch string, tags []string) bool {
+	switch {
+	case tag == goos || tag == goarch || slices.Contains(tags, tag):
+		return true
+	case tag == "unix":
+		return slices.Contains(unixOS, goos)
+	case tag == "linux":
+		return goos == "android"
+	case tag == "solaris":
+		return goos == "illumos"
+	case tag == "darwin":
+		return goos == "ios"
+	case tag == "gc":
+		return true
+	case tag == "cgo":
+		return goos == runtime.GOOS && goarch == runtime.GOARCH
+	case strings.HasPrefix(tag, "go1."):
+		return true
+	}
+	return false
+}
+
+// isBuiltinTag は GOOS/GOARCH 以外で go/build が設定するタグか、設定してはいけないタグかを返す
+func isBuiltinTag(tag string) bool {
+	return tag == "unix" || tag == "gc" || tag == "gccgo" || tag == "cgo" || tag == "ignore" || strings.HasPrefix(tag, "go1.")
+}
+
+// buildConstraint はファイルの //go:build の制約を返す。制約がなければ nil を返す
+func buildConstraint(filename string) (constraint.Expr, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if constraint.IsGoBuild(c.Text) {
+				return constraint.Parse(c.Text)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// osArchFromFileName は foo_linux.go や foo_windows_amd64_test.go のようなファイル名から GOOS と GOARCH を返す
+func osArchFromFileName(name string) (string, string) {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".go"), "_test")
+	parts := strings.Split(name, "_")
+	if len(parts) < 2 {
+		return "", ""
+	}
+	last := parts[len(parts)-1]
+	if len(parts) >= 3 && slices.Contains(knownOS, parts[len(parts)-2]) && slices.Contains(knownArch, last) {
+		return parts[len(parts)-2], last
+	}
+	if slices.Contains(knownOS, last) {
+		return last, ""
+	}
+	if slices.Contains(knownArch, last) {
+		return "", last
+	}
+	return "", ""
+}
+
+// buildTags はビルドフラグの -tags に指定されたタグを返す
+func buildTags(buildFlags []string) []string {
+	var tags []string
+	for i, flag := range buildFlags {
+		value, ok := strings.CutPrefix(flag, "-tags=")
+		if !ok && flag == "-tags" && i+1 < len(buildFlags) {
+			value, ok = buildFlags[i+1], true
+		}
+		if ok {
+			tags = append(tags, strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })...)
+		}
+	}
+	return tags
+}
+
+// withoutTags はビルドフラグから -tags を除く
+func withoutTags(buildFlags []string) []string {
+	var flags []string
+	for i := 0; i < len(buildFlags); i++ {
+		if buildFlags[i] == "-tags" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(buildFlags[i], "-tags=") {
+			continue
+		}
+		flags = append(flags, buildFlags[i])
+	}
+	return flags
+}
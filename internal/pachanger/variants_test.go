@@ -0,0 +1,31 @@
+package pachanger_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildVariants(t *testing.T) {
+	otherOS := "windows"
+	if runtime.GOOS == "windows" {
+		otherOS = "linux"
+	}
+	files := map[string]string{
+		"model/user.go":               "package model\n\ntype User struct{ Name string }\n",
+		"model/base.go":               "package model\n\ntype Base struct{}\n",
+		"app/app.go":                  "package app\n\nimport \"example.com/mod/model\"\n\nvar U model.User\n",
+		"app/app_" + otherOS + ".go":  "package app\n\nimport \"example.com/mod/model\"\n\nvar OS model.User\n",
+		"app/app_integration_test.go": "//go:build integration && !short\n\npackage app\n\nimport (\n\t\"testing\"\n\n\t\"example.com/mod/model\"\n)\n\nfunc TestUser(t *testing.T) { _ = model.User{} }\n",
+		"app/gen.go":                  "//go:build ignore\n\npackage main\n\nimport \"example.com/mod/model\"\n\nvar G model.User\n",
+	}
+
+	_, _, read := moveAndRead(t, files, moveConfig{}, "model/user.go", "model/user/user.go",
+		"model/base.go", "app/app.go", "app/app_"+otherOS+".go", "app/app_integration_test.go", "app/gen.go")
+	assert.Contains(t, read("app/app.go"), "var U user.User\n")
+	assert.Contains(t, read("app/app_"+otherOS+".go"), "var OS user.User\n")
+	assert.Contains(t, read("app/app_integration_test.go"), "_ = user.User{}")
+	// ignore タグのファイルは読み込まない
+	assert.Contains(t, read("app/gen.go"), "var G model.User\n")
+}